@@ -0,0 +1,141 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/sebnyberg/autodotenv"
+	"github.com/sebnyberg/flagtags"
+	"github.com/sebnyberg/policefeed/feed"
+	"github.com/urfave/cli/v2"
+)
+
+type migrateConfig struct {
+	feed.DBConfig
+}
+
+func NewMigrateCmd() *cli.Command {
+	var conf migrateConfig
+
+	if _, err := autodotenv.LoadDotenvIfExists(); err != nil {
+		log.Fatalln(err)
+	}
+
+	// withMigrate runs fn with a migrate instance for the configured database
+	withMigrate := func(fn func(c *cli.Context, m *migrate.Migrate) error) cli.ActionFunc {
+		return func(c *cli.Context) error {
+			db, err := conf.DBConfig.OpenDB()
+			if err != nil {
+				return fmt.Errorf("open database conn err, %w", err)
+			}
+			m, err := feed.NewMigrate(db)
+			if err != nil {
+				db.Close()
+				return fmt.Errorf("init migrations err, %w", err)
+			}
+			defer m.Close()
+			return fn(c, m)
+		}
+	}
+
+	return &cli.Command{
+		Name:  "migrate",
+		Usage: "migrate the Postgres schema",
+		Description: "Manage the Postgres schema using the migrations embedded in the binary.\n" +
+			fmt.Sprintf("This version of policefeed requires schema version %v.", feed.MigrationVersion),
+		Subcommands: []*cli.Command{
+			{
+				Name:   "up",
+				Usage:  "apply all pending migrations",
+				Action: withMigrate(runUp),
+				Flags:  flagtags.MustParseFlags(&conf),
+			},
+			{
+				Name:      "down",
+				Usage:     "revert the N most recent migrations",
+				ArgsUsage: "[N, default 1]",
+				Action:    withMigrate(runDown),
+				Flags:     flagtags.MustParseFlags(&conf),
+			},
+			{
+				Name:   "status",
+				Usage:  "print the current and required schema version",
+				Action: withMigrate(runStatus),
+				Flags:  flagtags.MustParseFlags(&conf),
+			},
+			{
+				Name:  "force",
+				Usage: "set the schema version without migrating, e.g. after fixing a failed migration",
+				Description: "Set the schema version and clear the dirty flag without running any\n" +
+					"migrations. Use it after manually fixing a failed migration.",
+				ArgsUsage: "N",
+				Action:    withMigrate(runForce),
+				Flags:     flagtags.MustParseFlags(&conf),
+			},
+		},
+	}
+}
+
+func runUp(c *cli.Context, m *migrate.Migrate) error {
+	err := m.Migrate(feed.MigrationVersion)
+	if errors.Is(err, migrate.ErrNoChange) {
+		fmt.Println("No pending migrations.")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return printStatus(m)
+}
+
+func runDown(c *cli.Context, m *migrate.Migrate) error {
+	n := 1
+	if c.Args().Present() {
+		var err error
+		if n, err = strconv.Atoi(c.Args().First()); err != nil || n <= 0 {
+			return fmt.Errorf("N must be a positive integer, got %q", c.Args().First())
+		}
+	}
+	if err := m.Steps(-n); err != nil {
+		return err
+	}
+	return printStatus(m)
+}
+
+func runStatus(c *cli.Context, m *migrate.Migrate) error {
+	return printStatus(m)
+}
+
+func runForce(c *cli.Context, m *migrate.Migrate) error {
+	if c.Args().Len() != 1 {
+		return errors.New("expected a single version argument")
+	}
+	version, err := strconv.Atoi(c.Args().First())
+	if err != nil || version < -1 {
+		return fmt.Errorf("version must be an integer, got %q", c.Args().First())
+	}
+	if err := m.Force(version); err != nil {
+		return err
+	}
+	return printStatus(m)
+}
+
+func printStatus(m *migrate.Migrate) error {
+	version, dirty, err := m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		fmt.Printf("Version: none, required: %v\n", feed.MigrationVersion)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Version: %v, required: %v", version, feed.MigrationVersion)
+	if dirty {
+		fmt.Print(" (dirty)")
+	}
+	fmt.Println()
+	return nil
+}
@@ -0,0 +1,45 @@
+package regions
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/sebnyberg/flagtags"
+	"github.com/sebnyberg/policefeed/feed"
+	"github.com/urfave/cli/v2"
+)
+
+type regionsConfig struct {
+	JSON bool `usage:"print regions as JSON"`
+}
+
+func NewRegionsCmd() *cli.Command {
+	var conf regionsConfig
+
+	return &cli.Command{
+		Name:        "regions",
+		Usage:       "list supported regions",
+		Description: "List the region IDs that can be used with --regions, with their RSS feed URL.",
+		Action: func(*cli.Context) error {
+			return runRegions(conf)
+		},
+		Flags: flagtags.MustParseFlags(&conf),
+	}
+}
+
+func runRegions(conf regionsConfig) error {
+	regions := feed.Regions()
+	if conf.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(regions)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tFEED URL")
+	for _, r := range regions {
+		fmt.Fprintf(w, "%v\t%v\t%v\n", r.ID, r.Name, r.FeedURL)
+	}
+	return w.Flush()
+}
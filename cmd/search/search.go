@@ -0,0 +1,96 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/sebnyberg/autodotenv"
+	"github.com/sebnyberg/flagtags"
+	"github.com/sebnyberg/policefeed/feed"
+	"github.com/urfave/cli/v2"
+)
+
+type searchConfig struct {
+	Limit   int  `value:"10" usage:"max number of results"`
+	NoColor bool `usage:"mark matches with brackets instead of bold text, the default when stdout is not a terminal"`
+	feed.DBConfig
+}
+
+func NewSearchCmd() *cli.Command {
+	var conf searchConfig
+
+	if _, err := autodotenv.LoadDotenvIfExists(); err != nil {
+		log.Fatalln(err)
+	}
+
+	return &cli.Command{
+		Name:      "search",
+		Usage:     "search stored events",
+		ArgsUsage: "QUERY",
+		Description: "Search the title, description and article contents of stored events.\n" +
+			"The query supports web search syntax, e.g. 'rån -väpnat \"Malmö\"'.",
+		Action: func(c *cli.Context) error {
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
+			defer cancel()
+			query := strings.Join(c.Args().Slice(), " ")
+			if query == "" {
+				return errors.New("missing search query")
+			}
+			return runSearch(ctx, conf, query)
+		},
+		Flags: flagtags.MustParseFlags(&conf),
+	}
+}
+
+func runSearch(ctx context.Context, conf searchConfig, query string) error {
+	if conf.Limit <= 0 {
+		return errors.New("limit must be positive")
+	}
+	db, err := conf.DBConfig.OpenDB()
+	if err != nil {
+		return fmt.Errorf("open database conn err, %w", err)
+	}
+	defer db.Close()
+
+	q := feed.SearchQuery{
+		Text:  query,
+		Limit: conf.Limit,
+	}
+	q.HighlightStart, q.HighlightStop = highlight(conf.NoColor || !isTerminal(os.Stdout))
+	results, err := feed.NewEventStorage(db).SearchEvents(ctx, q)
+	if err != nil {
+		return fmt.Errorf("search events err, %w", err)
+	}
+	if len(results) == 0 {
+		fmt.Println("No matching events.")
+		return nil
+	}
+	for i, res := range results {
+		fmt.Printf("%d. %v\n", i+1, res.Title)
+		fmt.Printf("   %v, %v\n", res.Region, res.PublishTime.Format("2006-01-02 15:04"))
+		fmt.Printf("   %v\n", strings.Join(strings.Fields(res.Snippet), " "))
+		fmt.Printf("   %v\n", res.URL)
+	}
+	return nil
+}
+
+// highlight returns the markers of matches in snippets, bold text unless
+// noColor is set.
+func highlight(noColor bool) (start, stop string) {
+	if noColor {
+		return "[", "]"
+	}
+	return "\x1b[1m", "\x1b[0m"
+}
+
+// isTerminal reports whether f is a terminal, as opposed to e.g. a pipe or a
+// file, which should not receive escape codes.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,30 @@
+package search
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunSearchLimit(t *testing.T) {
+	for _, limit := range []int{0, -1} {
+		err := runSearch(context.Background(), searchConfig{Limit: limit}, "rån")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "limit must be positive")
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	start, stop := highlight(true)
+	require.Equal(t, "[", start)
+	require.Equal(t, "]", stop)
+
+	// Redirected output is not a terminal
+	f, err := os.Create(filepath.Join(t.TempDir(), "out.txt"))
+	require.NoError(t, err)
+	defer f.Close()
+	require.False(t, isTerminal(f))
+}
@@ -0,0 +1,419 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sebnyberg/policefeed/feed"
+)
+
+const (
+	defaultEventsLimit = 50
+	maxEventsLimit     = 500
+)
+
+// api serves the HTTP API of the police feed server.
+type api struct {
+	events  feed.LatestEventLister
+	search  feed.EventSearcher
+	changes feed.ChangeLister
+	// pollInterval is the time between checks for new events in a stream.
+	pollInterval time.Duration
+	// sync requests an update from the RSS feeds, it is nil when updates
+	// cannot be triggered.
+	sync func()
+	// apiKeys are the keys accepted by the admin endpoints, which are not
+	// protected when it is empty.
+	apiKeys []string
+	// ready checks that dependencies such as the database are available, it
+	// is nil when there is nothing to check.
+	ready func(ctx context.Context) error
+	// staleAfter is the time without a successful fetch after which the feed
+	// of a region is reported as stale.
+	staleAfter time.Duration
+	// feedStatuses lists the stored feed statuses of all replicas, it is nil
+	// when only the statuses of this process are known.
+	feedStatuses func(ctx context.Context) ([]feed.FeedStatus, error)
+	// regionIDs are the regions updated by the server. Regions without a
+	// feed status are reported as stale.
+	regionIDs []string
+}
+
+func (a *api) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events", a.handleEvents)
+	mux.HandleFunc("/events/stream", a.handleEventStream)
+	mux.HandleFunc("/regions", a.handleRegions)
+	mux.HandleFunc("/admin/sync", a.requireAPIKey(a.handleSync))
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", a.handleHealth)
+	mux.HandleFunc("/readyz", a.handleReady)
+	mux.HandleFunc("/status/feeds", a.handleFeedStatus)
+	return mux
+}
+
+type eventsResponse struct {
+	Events []feed.PublicEvent `json:"events"`
+}
+
+type searchResponse struct {
+	Events []searchResult `json:"events"`
+}
+
+type searchResult struct {
+	feed.PublicEvent
+	Rank    float32 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
+
+// handleEvents lists the most recently published events. When the q parameter
+// is provided, events are instead ranked by how well they match the query.
+func (a *api) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	limit := defaultEventsLimit
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 || n > maxEventsLimit {
+			writeError(w, http.StatusBadRequest,
+				"limit must be an integer between 1 and "+strconv.Itoa(maxEventsLimit))
+			return
+		}
+		limit = n
+	}
+
+	if q := r.URL.Query().Get("q"); q != "" {
+		if a.search == nil {
+			writeError(w, http.StatusNotImplemented, "search is not supported by the storage")
+			return
+		}
+		results, err := a.search.SearchEvents(r.Context(), feed.SearchQuery{
+			Text:  q,
+			Limit: limit,
+		})
+		if err != nil {
+			feed.Logger(r.Context()).Error("Search events failed", "error", err)
+			writeError(w, http.StatusInternalServerError, "failed to search events")
+			return
+		}
+		resp := searchResponse{Events: make([]searchResult, len(results))}
+		for i, res := range results {
+			resp.Events[i] = searchResult{
+				PublicEvent: res.Public(),
+				Rank:        res.Rank,
+				Snippet:     res.Snippet,
+			}
+		}
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	events, err := a.events.ListLatestEvents(r.Context(), limit)
+	if err != nil {
+		feed.Logger(r.Context()).Error("List events failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to list events")
+		return
+	}
+	resp := eventsResponse{Events: make([]feed.PublicEvent, len(events))}
+	for i, evt := range events {
+		resp.Events[i] = evt.Public()
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+type regionsResponse struct {
+	Regions []regionResult `json:"regions"`
+}
+
+type regionResult struct {
+	feed.Region
+	// Status is the status of the RSS feed of the region, it is omitted for
+	// regions which are not updated by the server.
+	Status *regionStatus `json:"status,omitempty"`
+}
+
+type regionStatus struct {
+	LastAttempt *time.Time `json:"lastAttempt"`
+	LastSuccess *time.Time `json:"lastSuccess"`
+	ItemCount   int        `json:"itemCount"`
+	LastError   string     `json:"lastError,omitempty"`
+	Stale       bool       `json:"stale"`
+}
+
+// handleRegions lists the supported regions, together with the status of the
+// feeds of the regions updated by the server.
+func (a *api) handleRegions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	statuses, err := a.listFeedStatuses(r.Context())
+	if err != nil {
+		feed.Logger(r.Context()).Error("List feed statuses failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to list feed statuses")
+		return
+	}
+	byRegion := make(map[string]feedStatus, len(statuses))
+	for _, status := range statuses {
+		byRegion[status.RegionID] = status
+	}
+	regions := feed.Regions()
+	res := regionsResponse{Regions: make([]regionResult, len(regions))}
+	for i, region := range regions {
+		res.Regions[i] = regionResult{Region: region}
+		if status, ok := byRegion[region.ID]; ok {
+			res.Regions[i].Status = &regionStatus{
+				LastAttempt: status.LastAttempt,
+				LastSuccess: status.LastSuccess,
+				ItemCount:   status.ItemCount,
+				LastError:   status.LastError,
+				Stale:       status.Stale,
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// requireAPIKey rejects requests without one of the API keys as a bearer
+// token.
+func (a *api) requireAPIKey(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(a.apiKeys) == 0 {
+			next(w, r)
+			return
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		for _, key := range a.apiKeys {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(key)) == 1 {
+				next(w, r)
+				return
+			}
+		}
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, "missing or invalid API key")
+	}
+}
+
+// handleSync triggers an update from the RSS feeds without waiting for the
+// next interval. The update runs in the background.
+func (a *api) handleSync(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if a.sync == nil {
+		writeError(w, http.StatusNotImplemented, "sync is not supported")
+		return
+	}
+	a.sync()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+type statusResponse struct {
+	Status string `json:"status"`
+}
+
+// handleHealth reports that the server is running.
+func (a *api) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, statusResponse{Status: "ok"})
+}
+
+// handleReady reports whether the server can serve requests, i.e. whether the
+// database is reachable and has the expected schema.
+func (a *api) handleReady(w http.ResponseWriter, r *http.Request) {
+	if a.ready != nil {
+		if err := a.ready(r.Context()); err != nil {
+			// The error may reveal details of the database, which are only
+			// logged
+			feed.Logger(r.Context()).Warn("Readiness check failed", "error", err)
+			writeError(w, http.StatusServiceUnavailable, "database unavailable")
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, statusResponse{Status: "ok"})
+}
+
+type feedStatusResponse struct {
+	Feeds []feedStatus `json:"feeds"`
+}
+
+type feedStatus struct {
+	feed.FeedStatus
+	// Stale is true when the feed has not been fetched successfully within
+	// the stale threshold.
+	Stale bool `json:"stale"`
+}
+
+// handleFeedStatus reports the status of the RSS feed of each region fetched
+// or updated by the server.
+func (a *api) handleFeedStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	statuses, err := a.listFeedStatuses(r.Context())
+	if err != nil {
+		feed.Logger(r.Context()).Error("List feed statuses failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to list feed statuses")
+		return
+	}
+	writeJSON(w, http.StatusOK, feedStatusResponse{Feeds: statuses})
+}
+
+// listFeedStatuses lists the status of the RSS feed of each region fetched or
+// updated by the server, ordered by region ID.
+func (a *api) listFeedStatuses(ctx context.Context) ([]feedStatus, error) {
+	now := time.Now()
+	statuses := feed.FeedStatuses()
+	if a.feedStatuses != nil {
+		var err error
+		statuses, err = a.feedStatuses(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	known := make(map[string]bool, len(statuses))
+	for _, status := range statuses {
+		known[status.RegionID] = true
+	}
+	for _, regionID := range a.regionIDs {
+		if !known[regionID] {
+			statuses = append(statuses, feed.FeedStatus{RegionID: regionID})
+			known[regionID] = true
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].RegionID < statuses[j].RegionID
+	})
+	res := make([]feedStatus, len(statuses))
+	for i, status := range statuses {
+		res[i] = feedStatus{
+			FeedStatus: status,
+			Stale:      status.LastSuccess == nil || now.Sub(*status.LastSuccess) > a.staleAfter,
+		}
+	}
+	return res, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Write response failed", "error", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, struct {
+		Error string `json:"error"`
+	}{msg})
+}
+
+const (
+	streamBatchSize         = 100
+	streamKeepAliveInterval = 15 * time.Second
+)
+
+// handleEventStream streams created event revisions as server-sent events,
+// in the order they were committed.
+//
+// Each message has an opaque cursor as its ID. Clients resume a stream by
+// passing the last received cursor in the cursor parameter, or the
+// Last-Event-ID header. Without a cursor, the stream starts at the time given
+// by the since parameter (RFC3339), or at the time of the request.
+func (a *api) handleEventStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if a.changes == nil {
+		writeError(w, http.StatusNotImplemented, "streaming is not supported by the storage")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	cursor := feed.StartCursor(time.Now())
+	cursorStr := r.URL.Query().Get("cursor")
+	if cursorStr == "" {
+		cursorStr = r.Header.Get("Last-Event-ID")
+	}
+	if cursorStr != "" {
+		var err error
+		if cursor, err = feed.ParseChangeCursor(cursorStr); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	} else if since := r.URL.Query().Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "since must be an RFC3339 time")
+			return
+		}
+		cursor = feed.StartCursor(t)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	lastWrite := time.Now()
+	for {
+		changes, err := a.changes.ListEventChanges(r.Context(), cursor, streamBatchSize)
+		if err != nil {
+			if r.Context().Err() == nil {
+				feed.Logger(r.Context()).Error("List event changes failed", "error", err)
+			}
+			return
+		}
+		for _, change := range changes {
+			cursor = change.Cursor
+			data, err := json.Marshal(change.Public())
+			if err != nil {
+				feed.Logger(r.Context()).Error("Marshal event failed", "error", err)
+				return
+			}
+			if _, err := fmt.Fprintf(w, "id: %v\nevent: event\ndata: %s\n\n", cursor, data); err != nil {
+				return
+			}
+			lastWrite = time.Now()
+		}
+		if len(changes) == streamBatchSize {
+			flusher.Flush()
+			continue
+		}
+		if time.Since(lastWrite) > streamKeepAliveInterval {
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			lastWrite = time.Now()
+		}
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(a.pollInterval):
+		}
+	}
+}
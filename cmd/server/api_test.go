@@ -0,0 +1,265 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sebnyberg/policefeed/feed"
+	"github.com/sebnyberg/policefeed/feed/feedtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventStream(t *testing.T) {
+	ctx := context.Background()
+	storage := feed.NewMemoryStorage()
+	createTime := time.Date(2022, 2, 9, 12, 0, 0, 0, time.UTC)
+	newEvent := func(url string, revision int32) feed.Event {
+		createTime = createTime.Add(time.Minute)
+		return feed.Event{
+			ID:          feed.NewEventID(url),
+			URL:         url,
+			Revision:    revision,
+			CreateTime:  createTime,
+			ContentHash: []byte(url),
+		}
+	}
+	require.NoError(t, storage.CreateEvents(ctx, []feed.Event{
+		newEvent("https://polisen.se/a", 1),
+		newEvent("https://polisen.se/b", 1),
+	}))
+
+	a := &api{
+		events:       storage,
+		changes:      storage,
+		pollInterval: time.Millisecond,
+	}
+	srv := httptest.NewServer(a.routes())
+	defer srv.Close()
+
+	// read returns the URL and cursor of the next n events in the stream
+	read := func(sc *bufio.Scanner, n int) (urls []string, cursor string) {
+		for len(urls) < n && sc.Scan() {
+			line := sc.Text()
+			if strings.HasPrefix(line, "id: ") {
+				cursor = strings.TrimPrefix(line, "id: ")
+			}
+			if strings.HasPrefix(line, "data: ") {
+				var evt feed.PublicEvent
+				require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &evt))
+				urls = append(urls, evt.URL)
+			}
+		}
+		return urls, cursor
+	}
+	stream := func(query string) (*bufio.Scanner, func()) {
+		ctx, cancel := context.WithCancel(ctx)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+			srv.URL+"/events/stream?"+query, nil)
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		return bufio.NewScanner(resp.Body), func() {
+			cancel()
+			resp.Body.Close()
+		}
+	}
+
+	sc, stop := stream("since=2022-02-09T12:00:00Z")
+	urls, cursor := read(sc, 2)
+	require.Equal(t, []string{"https://polisen.se/a", "https://polisen.se/b"}, urls)
+
+	// New events are streamed as they are created
+	require.NoError(t, storage.CreateEvents(ctx, []feed.Event{
+		newEvent("https://polisen.se/a", 2),
+	}))
+	urls, _ = read(sc, 1)
+	require.Equal(t, []string{"https://polisen.se/a"}, urls)
+	stop()
+
+	// Resume from the cursor
+	sc, stop = stream("cursor=" + cursor)
+	defer stop()
+	urls, _ = read(sc, 1)
+	require.Equal(t, []string{"https://polisen.se/a"}, urls)
+
+	resp, err := http.Get(srv.URL + "/events/stream?cursor=invalid")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestHealth(t *testing.T) {
+	var readyErr error
+	a := &api{ready: func(context.Context) error { return readyErr }}
+	srv := httptest.NewServer(a.routes())
+	defer srv.Close()
+
+	get := func(path string) int {
+		resp, err := http.Get(srv.URL + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	require.Equal(t, http.StatusOK, get("/healthz"))
+	require.Equal(t, http.StatusOK, get("/readyz"))
+
+	readyErr = errors.New("ping database err, connection refused")
+	require.Equal(t, http.StatusOK, get("/healthz"))
+	require.Equal(t, http.StatusServiceUnavailable, get("/readyz"))
+
+	resp, err := http.Get(srv.URL + "/readyz")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "database unavailable")
+	require.NotContains(t, string(body), "connection refused")
+}
+
+func TestFeedStatus(t *testing.T) {
+	lastSuccess := time.Now().Add(-time.Minute)
+	a := &api{
+		staleAfter: 30 * time.Minute,
+		regionIDs:  []string{"skane", "blekinge"},
+		feedStatuses: func(context.Context) ([]feed.FeedStatus, error) {
+			return []feed.FeedStatus{{
+				RegionID:    "skane",
+				LastAttempt: &lastSuccess,
+				LastSuccess: &lastSuccess,
+				ItemCount:   20,
+			}}, nil
+		},
+	}
+	srv := httptest.NewServer(a.routes())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/status/feeds")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var got feedStatusResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+
+	// Regions without a status, e.g. after a restart, are stale
+	require.Len(t, got.Feeds, 2)
+	require.Equal(t, "blekinge", got.Feeds[0].RegionID)
+	require.Nil(t, got.Feeds[0].LastAttempt)
+	require.True(t, got.Feeds[0].Stale)
+	require.Equal(t, "skane", got.Feeds[1].RegionID)
+	require.Equal(t, 20, got.Feeds[1].ItemCount)
+	require.False(t, got.Feeds[1].Stale)
+}
+
+func TestRegions(t *testing.T) {
+	lastSuccess := time.Now().Add(-time.Minute)
+	a := &api{
+		staleAfter: 30 * time.Minute,
+		regionIDs:  []string{"skane", "blekinge"},
+		feedStatuses: func(context.Context) ([]feed.FeedStatus, error) {
+			return []feed.FeedStatus{{
+				RegionID:    "skane",
+				LastAttempt: &lastSuccess,
+				LastSuccess: &lastSuccess,
+				ItemCount:   20,
+			}}, nil
+		},
+	}
+	srv := httptest.NewServer(a.routes())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/regions")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var got regionsResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+	require.Len(t, got.Regions, len(feed.Regions()))
+
+	byID := make(map[string]regionResult)
+	for _, region := range got.Regions {
+		byID[region.ID] = region
+	}
+	require.NotNil(t, byID["skane"].Status)
+	require.Equal(t, 20, byID["skane"].Status.ItemCount)
+	require.False(t, byID["skane"].Status.Stale)
+	require.NotNil(t, byID["blekinge"].Status)
+	require.True(t, byID["blekinge"].Status.Stale)
+	// Regions which are not updated by the server have no status
+	require.Nil(t, byID["uppsala-lan"].Status)
+}
+
+func TestReadyPostgres(t *testing.T) {
+	db := feedtest.OpenPostgres(t)
+	s := &storage{db: db}
+	a := &api{ready: s.ready}
+	srv := httptest.NewServer(a.routes())
+	defer srv.Close()
+
+	// Readiness checks must not hold on to connections, or the pool runs dry
+	client := &http.Client{Timeout: 5 * time.Second}
+	for i := 0; i < 3*db.Stats().MaxOpenConnections; i++ {
+		resp, err := client.Get(srv.URL + "/readyz")
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	require.Zero(t, db.Stats().InUse)
+}
+
+// fakeSearcher returns results for any query, and records the last query.
+type fakeSearcher struct {
+	query   feed.SearchQuery
+	results []feed.SearchResult
+}
+
+func (s *fakeSearcher) SearchEvents(ctx context.Context, q feed.SearchQuery) ([]feed.SearchResult, error) {
+	s.query = q
+	return s.results, nil
+}
+
+func TestSearchEvents(t *testing.T) {
+	searcher := &fakeSearcher{results: []feed.SearchResult{{
+		Event: feed.Event{
+			URL:   "https://polisen.se/a",
+			Title: "09 februari 10:01, Rån, Malmö",
+		},
+		Rank:    0.5,
+		Snippet: "<b>Rån</b>, Malmö",
+	}}}
+	a := &api{events: feed.NewMemoryStorage(), search: searcher}
+	srv := httptest.NewServer(a.routes())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/events?q=r%C3%A5net&limit=5")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var got searchResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+	require.Equal(t, feed.SearchQuery{Text: "rånet", Limit: 5}, searcher.query)
+	require.Len(t, got.Events, 1)
+	require.Equal(t, "https://polisen.se/a", got.Events[0].URL)
+	require.Equal(t, "Rån", got.Events[0].Type)
+	require.Equal(t, float32(0.5), got.Events[0].Rank)
+	require.Equal(t, "<b>Rån</b>, Malmö", got.Events[0].Snippet)
+
+	get := func(a *api, path string) int {
+		srv := httptest.NewServer(a.routes())
+		defer srv.Close()
+		resp, err := http.Get(srv.URL + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	require.Equal(t, http.StatusBadRequest, get(a, "/events?q=rån&limit=0"))
+	require.Equal(t, http.StatusNotImplemented, get(&api{}, "/events?q=rån"))
+}
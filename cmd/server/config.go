@@ -0,0 +1,221 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/sebnyberg/flagtags"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// fileConfig contains the settings of a configuration file which have no
+// corresponding flag.
+type fileConfig struct {
+	// RegionIntervals overrides the update interval of regions by region ID.
+	RegionIntervals map[string]string `yaml:"region-intervals" toml:"region-intervals"`
+	Notifiers       []notifierConfig  `yaml:"notifiers" toml:"notifiers"`
+	// APIKeys are the keys accepted by the admin endpoints. When empty, the
+	// admin endpoints are not protected.
+	APIKeys []string `yaml:"api-keys" toml:"api-keys"`
+}
+
+type notifierConfig struct {
+	// Type is the kind of notifier, only webhook is supported.
+	Type string `yaml:"type" toml:"type"`
+	URL  string `yaml:"url" toml:"url"`
+}
+
+// fileOnlyKeys are the keys of a configuration file which are not flags.
+var fileOnlyKeys = map[string]bool{
+	"region-intervals": true,
+	"notifiers":        true,
+	"api-keys":         true,
+}
+
+// secretKeys are the keys whose values are redacted when printed.
+var secretKeys = map[string]bool{
+	"pgpassword": true,
+	"api-keys":   true,
+}
+
+// readConfigFile reads a YAML or TOML configuration file, the format is given
+// by the file extension. Flag settings are returned by flag name.
+func readConfigFile(path string) (map[string]interface{}, fileConfig, error) {
+	var values map[string]interface{}
+	var file fileConfig
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, file, fmt.Errorf("read config file err, %w", err)
+	}
+	switch ext := filepath.Ext(path); ext {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(b, &values); err != nil {
+			return nil, file, fmt.Errorf("parse config file err, %w", err)
+		}
+		if err := yaml.Unmarshal(b, &file); err != nil {
+			return nil, file, fmt.Errorf("parse config file err, %w", err)
+		}
+	case ".toml":
+		if _, err := toml.NewDecoder(bytes.NewReader(b)).Decode(&values); err != nil {
+			return nil, file, fmt.Errorf("parse config file err, %w", err)
+		}
+		if _, err := toml.NewDecoder(bytes.NewReader(b)).Decode(&file); err != nil {
+			return nil, file, fmt.Errorf("parse config file err, %w", err)
+		}
+	default:
+		return nil, file, fmt.Errorf("unknown config file format %q, use .yaml, .yml or .toml", ext)
+	}
+	for _, n := range file.Notifiers {
+		if n.Type != "webhook" {
+			return nil, file, fmt.Errorf("unknown notifier type %q, choose one of webhook", n.Type)
+		}
+		if n.URL == "" {
+			return nil, file, errors.New("notifier url is required")
+		}
+	}
+	for key := range fileOnlyKeys {
+		delete(values, key)
+	}
+	return values, file, nil
+}
+
+// applyConfigFile sets the flags of the command from the configuration file
+// at path, unless they were already set by a flag or environment variable.
+func applyConfigFile(c *cli.Context, path string) (fileConfig, error) {
+	if path == "" {
+		return fileConfig{}, nil
+	}
+	values, file, err := readConfigFile(path)
+	if err != nil {
+		return file, err
+	}
+
+	// Any server setting is accepted, so that commands can share a file
+	known := make(map[string]bool)
+	for _, f := range flagtags.MustParseFlags(&serverConfig{}) {
+		known[f.Names()[0]] = true
+	}
+	local := make(map[string]bool)
+	for _, f := range c.Command.Flags {
+		local[f.Names()[0]] = true
+	}
+	for key, v := range values {
+		if !known[key] {
+			return file, fmt.Errorf("unknown setting %q in config file", key)
+		}
+		if !local[key] || c.IsSet(key) {
+			continue
+		}
+		if err := c.Set(key, configValue(v)); err != nil {
+			return file, fmt.Errorf("invalid setting %q in config file, %w", key, err)
+		}
+	}
+	return file, nil
+}
+
+// configValue formats a value from a configuration file as a flag value.
+// Lists are joined by commas, e.g. for regions.
+func configValue(v interface{}) string {
+	list, ok := v.([]interface{})
+	if !ok {
+		return fmt.Sprint(v)
+	}
+	items := make([]string, len(list))
+	for i, item := range list {
+		items[i] = fmt.Sprint(item)
+	}
+	return strings.Join(items, ",")
+}
+
+// NewConfigCmd returns a command for inspecting the configuration.
+func NewConfigCmd() *cli.Command {
+	var conf serverConfig
+	var file fileConfig
+
+	return &cli.Command{
+		Name:  "config",
+		Usage: "inspect the server configuration",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "print",
+				Usage: "print the effective configuration with secrets redacted",
+				Description: "Print the configuration resulting from flags, environment " +
+					"variables and the config file, in that order of precedence.",
+				Before: func(c *cli.Context) error {
+					var err error
+					file, err = applyConfigFile(c, conf.Config)
+					return err
+				},
+				Action: func(c *cli.Context) error {
+					return printConfig(c, file)
+				},
+				Flags: flagtags.MustParseFlags(&conf),
+			},
+		},
+	}
+}
+
+// printConfig prints the flag values of the command and the settings of the
+// configuration file as YAML.
+func printConfig(c *cli.Context, file fileConfig) error {
+	values := make(map[string]interface{})
+	for _, f := range c.Command.Flags {
+		name := f.Names()[0]
+		if name == "config" || name == "help" {
+			continue
+		}
+		v := c.Value(name)
+		if s, ok := v.(string); ok {
+			v = redact(name, s)
+		}
+		values[name] = v
+	}
+	if len(file.RegionIntervals) > 0 {
+		values["region-intervals"] = file.RegionIntervals
+	}
+	if len(file.Notifiers) > 0 {
+		notifiers := make([]notifierConfig, len(file.Notifiers))
+		for i, n := range file.Notifiers {
+			notifiers[i] = notifierConfig{Type: n.Type, URL: redact("url", n.URL)}
+		}
+		values["notifiers"] = notifiers
+	}
+	if len(file.APIKeys) > 0 {
+		keys := make([]string, len(file.APIKeys))
+		for i, k := range file.APIKeys {
+			keys[i] = redact("api-keys", k)
+		}
+		values["api-keys"] = keys
+	}
+
+	enc := yaml.NewEncoder(c.App.Writer)
+	enc.SetIndent(2)
+	defer enc.Close()
+	return enc.Encode(values)
+}
+
+// redact hides the value of secret settings. Only the host of URLs is kept,
+// since webhook URLs often contain tokens.
+func redact(key, value string) string {
+	if value == "" {
+		return value
+	}
+	if secretKeys[key] {
+		return "REDACTED"
+	}
+	if strings.HasSuffix(key, "url") {
+		u, err := url.Parse(value)
+		if err != nil || u.Host == "" {
+			return "REDACTED"
+		}
+		return u.Scheme + "://" + u.Host + "/REDACTED"
+	}
+	return value
+}
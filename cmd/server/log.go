@@ -0,0 +1,41 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// LogConfig contains settings for the structured logs.
+type LogConfig struct {
+	LogFormat string `value:"text" usage:"log format, one of text,json"`
+	LogLevel  string `value:"info" usage:"minimum log level, one of debug,info,warn,error"`
+}
+
+// newLogger creates a logger which writes to w in the configured format.
+func (c LogConfig) newLogger(w io.Writer) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		return nil, fmt.Errorf("parse log level err, %w", err)
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	switch c.LogFormat {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q, choose one of text,json", c.LogFormat)
+	}
+}
+
+// setDefaultLogger makes the configured logger the default logger, which is
+// also used by the log package.
+func (c LogConfig) setDefaultLogger(w io.Writer) error {
+	logger, err := c.newLogger(w)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+	return nil
+}
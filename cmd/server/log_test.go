@@ -0,0 +1,28 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := LogConfig{LogFormat: "json", LogLevel: "warn"}.newLogger(&buf)
+	require.NoError(t, err)
+
+	logger.Info("Ignored")
+	logger.Warn("Fetch region failed", "region", "skane")
+	var line map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	require.Equal(t, "WARN", line["level"])
+	require.Equal(t, "Fetch region failed", line["msg"])
+	require.Equal(t, "skane", line["region"])
+
+	_, err = LogConfig{LogFormat: "xml", LogLevel: "info"}.newLogger(&buf)
+	require.Error(t, err)
+	_, err = LogConfig{LogFormat: "text", LogLevel: "verbose"}.newLogger(&buf)
+	require.Error(t, err)
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sebnyberg/autodotenv"
+	"github.com/sebnyberg/flagtags"
+	"github.com/sebnyberg/policefeed/feed"
+	"github.com/urfave/cli/v2"
+)
+
+// RetentionConfig contains settings for archiving old event revisions.
+type RetentionConfig struct {
+	RetentionDays int `value:"0" usage:"keep only the first and last revision of events not seen for this many days, archiving the others, 0 keeps all revisions"`
+}
+
+func (c RetentionConfig) retention() time.Duration {
+	return time.Duration(c.RetentionDays) * 24 * time.Hour
+}
+
+type pruneConfig struct {
+	Config string `env:"POLICEFEED_CONFIG" usage:"path to a YAML or TOML config file, flags and environment variables take precedence"`
+	DryRun bool   `usage:"report the revisions that would be archived without archiving them"`
+	RetentionConfig
+	StorageConfig
+	LogConfig
+}
+
+// NewPruneCmd returns a command which runs the retention policy once.
+func NewPruneCmd() *cli.Command {
+	var conf pruneConfig
+
+	if _, err := autodotenv.LoadDotenvIfExists(); err != nil {
+		log.Fatalln(err)
+	}
+
+	return &cli.Command{
+		Name:  "prune",
+		Usage: "archive old event revisions according to the retention policy",
+		Description: "Move all but the first and last revision of events which have not been " +
+			"seen for --retention-days to the archive table, and print the archived " +
+			"revisions per region. Requires postgres storage.",
+		Before: func(c *cli.Context) error {
+			_, err := applyConfigFile(c, conf.Config)
+			return err
+		},
+		Action: func(*cli.Context) error {
+			if err := conf.LogConfig.setDefaultLogger(os.Stderr); err != nil {
+				return err
+			}
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
+			defer cancel()
+			return runPrune(ctx, os.Stdout, conf)
+		},
+		Flags: flagtags.MustParseFlags(&conf),
+	}
+}
+
+func runPrune(ctx context.Context, w io.Writer, conf pruneConfig) error {
+	if conf.Storage != "postgres" {
+		return errors.New("prune requires postgres storage")
+	}
+	if conf.RetentionDays <= 0 {
+		return errors.New("retention days must be positive")
+	}
+	if conf.DryRun {
+		// Report against the current schema without changing it
+		conf.NoAutoMigrate = true
+	}
+	store, err := openStorage(conf.StorageConfig)
+	if err != nil {
+		return err
+	}
+	defer store.close()
+
+	policy := feed.NewRetentionPolicy(store.db, conf.retention())
+	if conf.DryRun {
+		stats, err := policy.Plan(ctx, time.Now())
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, "Would archive:")
+		return printPruneStats(w, stats)
+	}
+	stats, err := policy.Prune(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, "Archived:")
+	return printPruneStats(w, stats)
+}
+
+func printPruneStats(w io.Writer, stats []feed.PruneStats) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "REGION\tEVENTS\tREVISIONS")
+	var events, revisions int
+	for _, s := range stats {
+		fmt.Fprintf(tw, "%v\t%d\t%d\n", s.Region, s.Events, s.Revisions)
+		events += s.Events
+		revisions += s.Revisions
+	}
+	fmt.Fprintf(tw, "Total\t%d\t%d\n", events, revisions)
+	return tw.Flush()
+}
+
+// pruneEvents runs the retention policy and logs the outcome. Failures are
+// logged rather than returned, so that they do not stop the server.
+func pruneEvents(ctx context.Context, policy *feed.RetentionPolicy) {
+	start := time.Now()
+	stats, err := policy.Prune(ctx, start)
+	var events, revisions int
+	for _, s := range stats {
+		events += s.Events
+		revisions += s.Revisions
+	}
+	if err != nil {
+		if ctx.Err() == nil {
+			feed.Logger(ctx).Error("Prune event revisions failed",
+				"error", err, "revisions", revisions)
+		}
+		return
+	}
+	feed.Logger(ctx).Info("Pruned event revisions",
+		"events", events, "revisions", revisions, "duration", time.Since(start))
+}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/sebnyberg/policefeed/feed"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrintPruneStats(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, printPruneStats(&buf, []feed.PruneStats{
+		{Region: "Händelser RSS - Blekinge", Events: 2, Revisions: 5},
+		{Region: "Händelser RSS - Skåne", Events: 1, Revisions: 1},
+	}))
+	require.Equal(t, ""+
+		"REGION                    EVENTS  REVISIONS\n"+
+		"Händelser RSS - Blekinge  2       5\n"+
+		"Händelser RSS - Skåne     1       1\n"+
+		"Total                     3       6\n",
+		buf.String())
+}
+
+func TestRunPruneRequiresPostgres(t *testing.T) {
+	conf := pruneConfig{RetentionConfig: RetentionConfig{RetentionDays: 30}}
+	conf.Storage = "memory"
+	err := runPrune(context.Background(), new(bytes.Buffer), conf)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "requires postgres")
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sebnyberg/policefeed/feed"
+)
+
+// scheduler runs a function on an interval, or immediately when triggered.
+type scheduler struct {
+	interval time.Duration
+	// jitter is the maximum random delay added to each interval, to avoid
+	// several instances fetching the feeds at the same time.
+	jitter  time.Duration
+	trigger chan struct{}
+	run     func(ctx context.Context) error
+}
+
+func newScheduler(interval, jitter time.Duration, run func(ctx context.Context) error) *scheduler {
+	return &scheduler{
+		interval: interval,
+		jitter:   jitter,
+		trigger:  make(chan struct{}, 1),
+		run:      run,
+	}
+}
+
+// Run runs the function immediately and then after every interval until the
+// context is cancelled or the function returns an error.
+func (s *scheduler) Run(ctx context.Context) error {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-timer.C:
+		case <-s.trigger:
+			timer.Stop()
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if err := s.run(ctx); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		timer.Reset(s.next())
+	}
+}
+
+// Trigger requests a run as soon as possible. Triggers received while a run is
+// pending are coalesced into a single run.
+func (s *scheduler) Trigger() {
+	select {
+	case s.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (s *scheduler) next() time.Duration {
+	if s.jitter <= 0 {
+		return s.interval
+	}
+	return s.interval + time.Duration(rand.Int63n(int64(s.jitter)))
+}
+
+// regionSchedule is a group of regions updated on the same interval.
+type regionSchedule struct {
+	interval  time.Duration
+	regionIDs []string
+}
+
+// regionSchedules groups the comma-separated regions by update interval.
+// Regions without an interval in intervals use the default interval. An empty
+// list of regions selects all regions.
+func regionSchedules(
+	regions string,
+	defaultInterval time.Duration,
+	intervals map[string]string,
+) ([]regionSchedule, error) {
+	var regionIDs []string
+	if regions == "" {
+		for _, r := range feed.Regions() {
+			regionIDs = append(regionIDs, r.ID)
+		}
+	} else {
+		regionIDs = strings.Split(regions, ",")
+	}
+	selected := make(map[string]bool, len(regionIDs))
+	for _, id := range regionIDs {
+		selected[id] = true
+	}
+	for id := range intervals {
+		if !selected[id] {
+			return nil, fmt.Errorf("interval given for region %v which is not updated", id)
+		}
+	}
+
+	byInterval := make(map[time.Duration][]string)
+	for _, id := range regionIDs {
+		interval := defaultInterval
+		if s, exists := intervals[id]; exists {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return nil, fmt.Errorf("parse interval of region %v err, %w", id, err)
+			}
+			if d <= 0 {
+				return nil, fmt.Errorf("interval of region %v must be positive", id)
+			}
+			interval = d
+		}
+		byInterval[interval] = append(byInterval[interval], id)
+	}
+	schedules := make([]regionSchedule, 0, len(byInterval))
+	for interval, ids := range byInterval {
+		schedules = append(schedules, regionSchedule{interval: interval, regionIDs: ids})
+	}
+	sort.Slice(schedules, func(i, j int) bool {
+		return schedules[i].interval < schedules[j].interval
+	})
+	return schedules, nil
+}
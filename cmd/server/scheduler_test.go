@@ -0,0 +1,70 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sebnyberg/policefeed/feed"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runs := make(chan struct{})
+	s := newScheduler(time.Hour, time.Minute, func(ctx context.Context) error {
+		select {
+		case runs <- struct{}{}:
+		case <-ctx.Done():
+		}
+		return nil
+	})
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+
+	wait := func() {
+		t.Helper()
+		select {
+		case <-runs:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for run")
+		}
+	}
+
+	// Runs immediately on start
+	wait()
+
+	// Runs again when triggered, without waiting for the interval
+	s.Trigger()
+	wait()
+
+	// Returns when the context is cancelled
+	cancel()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for scheduler to stop")
+	}
+}
+
+func TestRegionSchedules(t *testing.T) {
+	got, err := regionSchedules("", 5*time.Minute, nil)
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	require.Len(t, got[0].regionIDs, len(feed.Regions()))
+
+	got, err = regionSchedules("stockholms-lan,skane,blekinge", 5*time.Minute, map[string]string{
+		"stockholms-lan": "1m",
+	})
+	require.NoError(t, err)
+	require.Equal(t, []regionSchedule{
+		{time.Minute, []string{"stockholms-lan"}},
+		{5 * time.Minute, []string{"skane", "blekinge"}},
+	}, got)
+
+	_, err = regionSchedules("skane", 5*time.Minute, map[string]string{"stockholms-lan": "1m"})
+	require.Error(t, err)
+}
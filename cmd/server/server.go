@@ -1,30 +1,53 @@
+// Package server contains the server command, and the commands which run a
+// part of the server once or act on its configuration: sync, prune and
+// config. Unlike the other commands, which have a package each, these share
+// the storage, config file, logging and tracing setup of the server, which
+// would otherwise have to be exported from here.
 package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
-	"strings"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/sebnyberg/autodotenv"
 	"github.com/sebnyberg/flagtags"
 	"github.com/sebnyberg/policefeed/feed"
 	"github.com/urfave/cli/v2"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"golang.org/x/sync/errgroup"
 )
 
 type serverConfig struct {
-	Addr    string `value:"localhost:0" usage:"Address, random port is allocated when zero"`
-	Regions string `value:"" usage:"comma-separated list of region IDs from the Swedish Police Website"`
-	feed.DBConfig
+	Config           string `env:"POLICEFEED_CONFIG" usage:"path to a YAML or TOML config file, flags and environment variables take precedence"`
+	Addr             string `value:"localhost:0" usage:"Address, random port is allocated when zero"`
+	Regions          string `value:"" usage:"comma-separated list of region IDs from the Swedish Police Website"`
+	Interval         string `value:"5m" usage:"time between updates from the RSS feeds"`
+	Jitter           string `value:"0s" usage:"maximum random delay added to the update interval"`
+	StaleAfter       string `value:"30m" usage:"report the feed of a region as stale when it has not been fetched successfully for this long"`
+	NotifyWebhookURL string `name:"notify-webhook-url" env:"NOTIFY_WEBHOOK_URL" usage:"deliver notifications about created events to this URL, requires postgres storage"`
+	ShardRegions     bool   `usage:"split regions between replicas sharing the postgres database, instead of electing a single replica which updates all regions"`
+	ReplicaID        string `name:"replica-id" env:"REPLICA_ID" usage:"unique ID of the replica when sharding regions, defaults to the hostname"`
+	PruneInterval    string `value:"1h" usage:"time between runs of the retention policy, see --retention-days"`
+	RetentionConfig
+	StorageConfig
+	MirrorConfig
+	LogConfig
+	TraceConfig
 }
 
 func NewServerCmd() *cli.Command {
 	var conf serverConfig
+	var file fileConfig
 
 	if _, err := autodotenv.LoadDotenvIfExists(); err != nil {
 		log.Fatalln(err)
@@ -34,12 +57,20 @@ func NewServerCmd() *cli.Command {
 		Name:        "server",
 		Usage:       "start the police feed server",
 		Description: "Start the server on the provided address.",
+		Before: func(c *cli.Context) error {
+			var err error
+			file, err = applyConfigFile(c, conf.Config)
+			return err
+		},
 		Action: func(*cli.Context) error {
+			if err := conf.LogConfig.setDefaultLogger(os.Stderr); err != nil {
+				return err
+			}
 			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
 			defer cancel()
 			g, ctx := errgroup.WithContext(ctx)
 			g.Go(func() error {
-				return runServer(ctx, conf)
+				return runServer(ctx, conf, file)
 			})
 			return g.Wait()
 		},
@@ -47,36 +78,264 @@ func NewServerCmd() *cli.Command {
 	}
 }
 
+// updaterLockKey is the Postgres advisory lock key held by the replica which
+// updates events.
+const updaterLockKey = 0x706f6c696365 // "police"
+
 type server struct {
 	addr net.Addr
 }
 
-func runServer(ctx context.Context, conf serverConfig) error {
-	// Database connection setup & check
-	db, err := conf.DBConfig.OpenDB()
+func runServer(ctx context.Context, conf serverConfig, file fileConfig) error {
+	if (conf.NotifyWebhookURL != "" || len(file.Notifiers) > 0) && conf.Storage != "postgres" {
+		return errors.New("notifications require postgres storage")
+	}
+	if conf.ShardRegions && conf.Storage != "postgres" {
+		return errors.New("sharding regions requires postgres storage")
+	}
+	if conf.RetentionDays > 0 && conf.Storage != "postgres" {
+		return errors.New("retention requires postgres storage")
+	}
+	interval, err := time.ParseDuration(conf.Interval)
+	if err != nil {
+		return fmt.Errorf("parse interval err, %w", err)
+	}
+	if interval <= 0 {
+		return errors.New("interval must be positive")
+	}
+	jitter, err := time.ParseDuration(conf.Jitter)
+	if err != nil {
+		return fmt.Errorf("parse jitter err, %w", err)
+	}
+	staleAfter, err := time.ParseDuration(conf.StaleAfter)
+	if err != nil {
+		return fmt.Errorf("parse stale after err, %w", err)
+	}
+	pruneInterval, err := time.ParseDuration(conf.PruneInterval)
+	if err != nil {
+		return fmt.Errorf("parse prune interval err, %w", err)
+	}
+	if conf.RetentionDays > 0 && pruneInterval <= 0 {
+		return errors.New("prune interval must be positive")
+	}
+	schedules, err := regionSchedules(conf.Regions, interval, file.RegionIntervals)
+	if err != nil {
+		return err
+	}
+
+	shutdownTracing, err := conf.TraceConfig.setupTracing(ctx)
+	if err != nil {
+		return err
+	}
+	defer flushTraces(shutdownTracing)
+
+	// Storage setup & check
+	store, err := openStorage(conf.StorageConfig)
 	if err != nil {
-		return fmt.Errorf("open database conn err, %w", err)
+		return err
 	}
-	if err := feed.ValidateSchema(db); err != nil {
-		return fmt.Errorf("validate database schema err, %w", err)
+	defer store.close()
+	eventStorage := store.events
+	if store.db != nil {
+		prometheus.MustRegister(collectors.NewDBStatsCollector(store.db, "policefeed"))
 	}
 
-	// Create RSS feed fetcher
-	rssFeed := feed.NewRSSAdapter(strings.Split(conf.Regions, ","), feed.EventsFromRSS)
+	// Search and streaming is only supported by some storage backends
+	searcher, _ := eventStorage.(feed.EventSearcher)
+	changes, _ := eventStorage.(feed.ChangeLister)
 
-	// Init database eventStorage
-	eventStorage := feed.NewEventStorage(db)
+	mirrors, err := openMirrors(conf.MirrorConfig)
+	if err != nil {
+		return err
+	}
 
-	g, ctx := errgroup.WithContext(ctx)
-	g.Go(func() error {
+	// Mirror created events to secondary sinks
+	var target feed.EventListerCreator = eventStorage
+	var fanout *feed.FanoutStorage
+	if len(mirrors) > 0 {
+		fanout = feed.NewFanoutStorage(eventStorage, mirrors...)
+		target = fanout
+	}
+
+	var regionIDs []string
+	for _, sched := range schedules {
+		regionIDs = append(regionIDs, sched.regionIDs...)
+	}
+
+	// Only one replica sharing the database updates a region, either by
+	// electing a single replica or by leasing regions to replicas
+	var leases *feed.RegionLeases
+	if conf.ShardRegions {
+		replicaID := conf.ReplicaID
+		if replicaID == "" {
+			if replicaID, err = os.Hostname(); err != nil {
+				return fmt.Errorf("get hostname err, %w", err)
+			}
+		}
+		leases = feed.NewRegionLeases(store.db, replicaID, regionIDs)
+	}
+
+	// Share the feed statuses with the other replicas
+	statusStore, _ := eventStorage.(feed.FeedStatusStore)
+
+	// Update events from the RSS feeds, one scheduler per interval
+	scheds := make([]*scheduler, len(schedules))
+	for i, sched := range schedules {
+		regionIDs := sched.regionIDs
 		up := feed.NewUpdater()
-		for {
-			if err := up.Update(ctx, rssFeed, eventStorage); err != nil {
-				return err
+		update := func(ctx context.Context, regionIDs []string, target feed.EventListerCreator) error {
+			if len(regionIDs) == 0 {
+				return nil
+			}
+			rssFeed := feed.NewRSSAdapter(regionIDs, feed.EventsFromRSS)
+			_, err := up.Update(ctx, rssFeed, target)
+			if statusStore != nil {
+				saveFeedStatuses(ctx, statusStore, regionIDs)
 			}
-			time.Sleep(time.Minute * 5)
+			return err
+		}
+		scheds[i] = newScheduler(sched.interval, jitter, func(ctx context.Context) error {
+			if leases == nil {
+				return update(ctx, regionIDs, target)
+			}
+			return leases.Use(regionIDs, func(owned []string) error {
+				// Events are only stored while the leases are still held
+				err := update(ctx, owned, leases.Fence(target, owned))
+				if errors.Is(err, feed.ErrLeaseLost) {
+					feed.Logger(ctx).Warn("Skipped storing events of lost regions", "error", err)
+					return nil
+				}
+				return err
+			})
+		})
+	}
+	syncAll := func() {
+		for _, sched := range scheds {
+			sched.Trigger()
+		}
+	}
+	if leases != nil {
+		leases.OnChange(syncAll)
+	}
+
+	// Maintain the storage alongside the updates. Maintenance is run by the
+	// leader only, also when regions are sharded, starting when it is elected.
+	var jobs []*scheduler
+	if store.db != nil {
+		jobs = append(jobs, newScheduler(24*time.Hour, 0,
+			func(ctx context.Context) error {
+				store.ensurePartitions(ctx)
+				return nil
+			},
+		))
+	}
+	if conf.RetentionDays > 0 {
+		policy := feed.NewRetentionPolicy(store.db, conf.retention())
+		jobs = append(jobs, newScheduler(pruneInterval, 0,
+			func(ctx context.Context) error {
+				pruneEvents(ctx, policy)
+				return nil
+			},
+		))
+	}
+
+	// Start HTTP API
+	lis, err := net.Listen("tcp", conf.Addr)
+	if err != nil {
+		return fmt.Errorf("listen err, %w", err)
+	}
+	srv := server{addr: lis.Addr()}
+	slog.Info("Listening", "addr", srv.addr.String())
+	g, ctx := errgroup.WithContext(ctx)
+	a := &api{
+		events:       eventStorage,
+		search:       searcher,
+		changes:      changes,
+		pollInterval: 2 * time.Second,
+		sync:         syncAll,
+		apiKeys:      file.APIKeys,
+		ready:        store.ready,
+		staleAfter:   staleAfter,
+		regionIDs:    regionIDs,
+	}
+	if statusStore != nil {
+		a.feedStatuses = statusStore.ListFeedStatuses
+	}
+	httpServer := &http.Server{
+		Handler: otelhttp.NewHandler(a.routes(), "api", otelhttp.WithSpanNameFormatter(
+			func(_ string, r *http.Request) string { return r.Method + " " + r.URL.Path },
+		)),
+		// Cancel requests, e.g. event streams, on shutdown
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	g.Go(func() error {
+		if err := httpServer.Serve(lis); err != http.ErrServerClosed {
+			return err
 		}
+		return nil
+	})
+	g.Go(func() error {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		return httpServer.Shutdown(shutdownCtx)
 	})
 
+	if fanout != nil {
+		g.Go(func() error {
+			return fanout.Run(ctx)
+		})
+	}
+
+	// Relay notifications from the transactional outbox
+	if store.db != nil {
+		var notifiers []feed.Notifier
+		if conf.NotifyWebhookURL != "" {
+			notifiers = append(notifiers, feed.NewWebhook(conf.NotifyWebhookURL))
+		}
+		for _, n := range file.Notifiers {
+			notifiers = append(notifiers, feed.NewWebhook(n.URL))
+		}
+		relay := feed.NewOutboxRelay(store.db, notifiers...)
+		g.Go(func() error {
+			return relay.Run(ctx)
+		})
+	}
+
+	runSchedulers := func(jobs []*scheduler) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			g, ctx := errgroup.WithContext(ctx)
+			for _, sched := range jobs {
+				sched := sched
+				g.Go(func() error {
+					return sched.Run(ctx)
+				})
+			}
+			return g.Wait()
+		}
+	}
+	switch {
+	case leases != nil:
+		g.Go(func() error {
+			return leases.Run(ctx)
+		})
+		g.Go(func() error {
+			return runSchedulers(scheds)(ctx)
+		})
+		election := feed.NewLeaderElection(store.db, updaterLockKey)
+		g.Go(func() error {
+			return election.RunAsLeader(ctx, runSchedulers(jobs))
+		})
+	case store.db != nil:
+		election := feed.NewLeaderElection(store.db, updaterLockKey)
+		g.Go(func() error {
+			return election.RunAsLeader(ctx, runSchedulers(append(scheds, jobs...)))
+		})
+	default:
+		g.Go(func() error {
+			return runSchedulers(append(scheds, jobs...))(ctx)
+		})
+	}
+
 	return g.Wait()
 }
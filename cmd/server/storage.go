@@ -0,0 +1,182 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/sebnyberg/policefeed/feed"
+)
+
+// eventStore is the storage used by the server.
+type eventStore interface {
+	feed.EventListerCreator
+	feed.LatestEventLister
+}
+
+// storage is the storage backend selected by the configuration.
+type storage struct {
+	events eventStore
+	// db is the Postgres database, it is nil for other storage backends.
+	db *sql.DB
+	// partitionMonthsAhead is the number of months to create Postgres
+	// partitions ahead of time.
+	partitionMonthsAhead int
+	// close releases any resources held by the storage.
+	close func() error
+}
+
+// ready checks that the database is reachable and has the expected schema.
+func (s *storage) ready(ctx context.Context) error {
+	if s.db == nil {
+		return nil
+	}
+	if err := s.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("ping database err, %w", err)
+	}
+	if err := feed.CheckSchema(ctx, s.db); err != nil {
+		return fmt.Errorf("check schema err, %w", err)
+	}
+	return nil
+}
+
+// ensurePartitions creates the partitions of the Postgres event table for the
+// coming months. Failures are logged rather than returned, since events can
+// still be stored until the existing partitions run out.
+func (s *storage) ensurePartitions(ctx context.Context) {
+	if s.db == nil {
+		return
+	}
+	created, err := feed.EnsurePartitions(ctx, s.db, time.Now(), s.partitionMonthsAhead)
+	if len(created) > 0 {
+		feed.Logger(ctx).Info("Created event partitions", "partitions", created)
+	}
+	if err != nil && ctx.Err() == nil {
+		feed.Logger(ctx).Error("Create event partitions failed", "error", err)
+	}
+}
+
+// saveFeedStatuses stores the feed statuses of the regions, as fetched by
+// this process. Failures are logged rather than returned, since the events
+// have been stored regardless.
+func saveFeedStatuses(ctx context.Context, store feed.FeedStatusStore, regionIDs []string) {
+	selected := make(map[string]bool, len(regionIDs))
+	for _, id := range regionIDs {
+		selected[id] = true
+	}
+	var statuses []feed.FeedStatus
+	for _, status := range feed.FeedStatuses() {
+		if selected[status.RegionID] {
+			statuses = append(statuses, status)
+		}
+	}
+	if err := store.SaveFeedStatuses(ctx, statuses); err != nil && ctx.Err() == nil {
+		feed.Logger(ctx).Error("Save feed statuses failed", "error", err)
+	}
+}
+
+// StorageConfig contains settings for selecting and opening the storage
+// backend.
+type StorageConfig struct {
+	Storage       string `value:"postgres" usage:"storage backend, one of postgres,sqlite,file,memory"`
+	SQLitePath    string `name:"sqlite-path" env:"SQLITE_PATH" value:"policefeed.db" usage:"path to the database file when using sqlite storage"`
+	StorageDir    string `value:"events" usage:"directory of daily gzip-compressed JSONL files when using file storage"`
+	NoAutoMigrate bool   `usage:"do not migrate the postgres schema on start, refuse to start unless it is at the required version"`
+	// PartitionMonthsAhead is the number of monthly partitions of the
+	// postgres event table that are created ahead of time.
+	PartitionMonthsAhead int `value:"3" usage:"create monthly partitions of the postgres event table this many months ahead"`
+	feed.DBConfig
+}
+
+// openStorage opens the storage backend selected by the configuration.
+func openStorage(conf StorageConfig) (*storage, error) {
+	switch conf.Storage {
+	case "postgres":
+		db, err := conf.DBConfig.OpenDB()
+		if err != nil {
+			return nil, fmt.Errorf("open database conn err, %w", err)
+		}
+		checkSchema := feed.ValidateSchema
+		if conf.NoAutoMigrate {
+			checkSchema = func(db *sql.DB) error {
+				return feed.CheckSchema(context.Background(), db)
+			}
+		}
+		if err := checkSchema(db); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("validate database schema err, %w", err)
+		}
+		return &storage{
+			events:               feed.NewEventStorage(db),
+			db:                   db,
+			partitionMonthsAhead: conf.PartitionMonthsAhead,
+			close:                db.Close,
+		}, nil
+	case "sqlite":
+		s, err := feed.OpenSQLiteStorage(conf.SQLitePath)
+		if err != nil {
+			return nil, fmt.Errorf("open sqlite storage err, %w", err)
+		}
+		return &storage{events: s, close: s.Close}, nil
+	case "file":
+		s, err := feed.OpenFileStorage(conf.StorageDir)
+		if err != nil {
+			return nil, fmt.Errorf("open file storage err, %w", err)
+		}
+		return &storage{events: s, close: func() error { return nil }}, nil
+	case "memory":
+		return &storage{
+			events: feed.NewMemoryStorage(),
+			close:  func() error { return nil },
+		}, nil
+	default:
+		return nil, fmt.Errorf(
+			"unknown storage %q, choose one of postgres,sqlite,file,memory", conf.Storage)
+	}
+}
+
+// MirrorConfig contains settings for mirroring created events to secondary
+// sinks in addition to the storage.
+type MirrorConfig struct {
+	MirrorDir         string `usage:"mirror created events to daily JSONL files in this directory"`
+	MirrorWebhookURL  string `name:"mirror-webhook-url" env:"MIRROR_WEBHOOK_URL" usage:"mirror created events by posting them to this URL"`
+	MirrorMaxAttempts int    `value:"5" usage:"max delivery attempts per batch before a batch is dead-lettered"`
+	DeadLetterDir     string `value:"dead-letter" usage:"directory where events that could not be mirrored are stored, one subdirectory per mirror"`
+}
+
+// openMirrors creates the configured mirrors, each with its own dead letter
+// storage.
+func openMirrors(conf MirrorConfig) ([]*feed.Mirror, error) {
+	sinks := make(map[string]feed.EventCreator)
+	if conf.MirrorDir != "" {
+		s, err := feed.OpenFileStorage(conf.MirrorDir)
+		if err != nil {
+			return nil, fmt.Errorf("open mirror dir err, %w", err)
+		}
+		sinks["file"] = s
+	}
+	if conf.MirrorWebhookURL != "" {
+		sinks["webhook"] = feed.NewWebhook(conf.MirrorWebhookURL)
+	}
+
+	var mirrors []*feed.Mirror
+	for _, name := range []string{"file", "webhook"} {
+		sink, exists := sinks[name]
+		if !exists {
+			continue
+		}
+		deadLetter, err := feed.OpenFileStorage(filepath.Join(conf.DeadLetterDir, name))
+		if err != nil {
+			return nil, fmt.Errorf("open dead letter dir err, %w", err)
+		}
+		mirrors = append(mirrors, feed.NewMirror(feed.MirrorConfig{
+			Name:        name,
+			Sink:        sink,
+			DeadLetter:  deadLetter,
+			MaxAttempts: conf.MirrorMaxAttempts,
+		}))
+	}
+	return mirrors, nil
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+
+	"github.com/sebnyberg/autodotenv"
+	"github.com/sebnyberg/flagtags"
+	"github.com/sebnyberg/policefeed/feed"
+	"github.com/urfave/cli/v2"
+)
+
+type syncConfig struct {
+	Config  string `env:"POLICEFEED_CONFIG" usage:"path to a YAML or TOML config file, flags and environment variables take precedence"`
+	Regions string `value:"" usage:"comma-separated list of region IDs from the Swedish Police Website"`
+	StorageConfig
+	LogConfig
+	TraceConfig
+}
+
+// NewSyncCmd returns a command which runs a single update and exits, e.g. as
+// a scheduled job instead of a long-running server.
+func NewSyncCmd() *cli.Command {
+	var conf syncConfig
+
+	if _, err := autodotenv.LoadDotenvIfExists(); err != nil {
+		log.Fatalln(err)
+	}
+
+	return &cli.Command{
+		Name:  "sync",
+		Usage: "fetch events from the RSS feeds once and store them",
+		Description: "Run a single update of the storage and print a summary. " +
+			"Exits with code 2 if some regions could not be fetched. Events removed " +
+			"from the feed are not detected, since detection needs several fetches " +
+			"by the same process.",
+		Before: func(c *cli.Context) error {
+			_, err := applyConfigFile(c, conf.Config)
+			return err
+		},
+		Action: func(*cli.Context) error {
+			if err := conf.LogConfig.setDefaultLogger(os.Stderr); err != nil {
+				return err
+			}
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
+			defer cancel()
+			return runSync(ctx, os.Stdout, conf)
+		},
+		Flags: flagtags.MustParseFlags(&conf),
+	}
+}
+
+func runSync(ctx context.Context, w io.Writer, conf syncConfig) error {
+	shutdownTracing, err := conf.TraceConfig.setupTracing(ctx)
+	if err != nil {
+		return err
+	}
+	defer flushTraces(shutdownTracing)
+
+	store, err := openStorage(conf.StorageConfig)
+	if err != nil {
+		return err
+	}
+	defer store.close()
+	store.ensurePartitions(ctx)
+
+	rssFeed := feed.NewRSSAdapter(strings.Split(conf.Regions, ","), feed.EventsFromRSS)
+	res, err := feed.NewUpdater().Update(ctx, rssFeed, store.events)
+	if err != nil {
+		return err
+	}
+	printSyncResult(w, res)
+	if res.FailedRegions != nil {
+		return cli.Exit(fmt.Sprintf("failed to fetch %d regions", len(res.FailedRegions)), 2)
+	}
+	return nil
+}
+
+func printSyncResult(w io.Writer, res feed.UpdateResult) {
+	fmt.Fprintf(w, "Created:   %d\n", res.Created)
+	fmt.Fprintf(w, "Revised:   %d\n", res.Revised)
+	fmt.Fprintf(w, "Unchanged: %d\n", res.Unchanged)
+	fmt.Fprintf(w, "Removed:   %d\n", res.Removed)
+	fmt.Fprintf(w, "Failed:    %d\n", len(res.FailedRegions))
+	ids := make([]string, 0, len(res.FailedRegions))
+	for id := range res.FailedRegions {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		fmt.Fprintf(w, "  %v: %v\n", id, res.FailedRegions[id])
+	}
+}
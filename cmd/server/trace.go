@@ -0,0 +1,50 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+// TraceConfig contains settings for exporting traces.
+type TraceConfig struct {
+	OTLPEndpoint string `name:"otlp-endpoint" env:"OTLP_ENDPOINT" usage:"export traces over OTLP/HTTP to this URL, e.g. http://localhost:4318, tracing is disabled when empty"`
+}
+
+// setupTracing installs a global tracer provider which exports spans to the
+// configured endpoint. The returned function flushes pending spans.
+func (c TraceConfig) setupTracing(ctx context.Context) (shutdown func(context.Context) error, err error) {
+	if c.OTLPEndpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(c.OTLPEndpoint))
+	if err != nil {
+		return nil, fmt.Errorf("create trace exporter err, %w", err)
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			semconv.ServiceName("policefeed"),
+		)),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return tp.Shutdown, nil
+}
+
+// flushTraces exports pending spans before exiting.
+func flushTraces(shutdown func(context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdown(ctx); err != nil {
+		slog.Error("Flush traces failed", "error", err)
+	}
+}
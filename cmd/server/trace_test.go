@@ -0,0 +1,63 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/sebnyberg/policefeed/feed"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace/noop"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestTracing(t *testing.T) {
+	// Local collector which records the names of exported spans
+	var mtx sync.Mutex
+	var spanNames []string
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v1/traces", r.URL.Path)
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		var req coltracepb.ExportTraceServiceRequest
+		require.NoError(t, proto.Unmarshal(body, &req))
+		mtx.Lock()
+		defer mtx.Unlock()
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				for _, span := range ss.Spans {
+					spanNames = append(spanNames, span.Name)
+				}
+			}
+		}
+	}))
+	defer collector.Close()
+
+	ctx := context.Background()
+	shutdown, err := TraceConfig{OTLPEndpoint: collector.URL}.setupTracing(ctx)
+	require.NoError(t, err)
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	source := feed.NewRSSAdapter([]string{"skane"},
+		func(ctx context.Context, regionIDs []string) ([]feed.Event, error) {
+			return []feed.Event{{ID: feed.NewEventID("a"), ContentHash: []byte("a")}}, nil
+		},
+	)
+	_, err = feed.NewUpdater().Update(ctx, source, feed.NewMemoryStorage())
+	require.NoError(t, err)
+	require.NoError(t, shutdown(ctx))
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	require.ElementsMatch(t, []string{
+		"Updater.Update",
+		"list source events",
+		"list existing events",
+		"diff events",
+	}, spanNames)
+}
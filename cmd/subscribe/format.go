@@ -0,0 +1,74 @@
+package subscribe
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+
+	"github.com/sebnyberg/policefeed/feed"
+)
+
+// formatter writes an event to w.
+type formatter func(w io.Writer, evt feed.Event) error
+
+// newFormatter returns the formatter for the format. The template text is
+// only used by the template format.
+func newFormatter(format, text string) (formatter, error) {
+	switch format {
+	case "text":
+		return formatText, nil
+	case "json":
+		return formatJSON, nil
+	case "ndjson":
+		return formatNDJSON, nil
+	case "template":
+		if text == "" {
+			return nil, fmt.Errorf("the template format requires a template")
+		}
+		if !strings.HasSuffix(text, "\n") {
+			text += "\n"
+		}
+		tmpl, err := template.New("event").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("parse template err, %w", err)
+		}
+		return func(w io.Writer, evt feed.Event) error {
+			return tmpl.Execute(w, evt.Public())
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown format %q, choose one of text,json,ndjson,template", format)
+	}
+}
+
+// formatText writes the event in a human-readable format. As required by the
+// Police, the text makes clear that the Police is the source, and links to
+// the article on polisen.se.
+func formatText(w io.Writer, evt feed.Event) error {
+	status := "new"
+	switch {
+	case evt.Removed:
+		status = "removed"
+	case evt.Revision > 1:
+		status = "updated"
+	}
+	region := strings.TrimPrefix(evt.Region, "Händelser RSS - ")
+	_, err := fmt.Fprintf(w, "%v [%v] %v | %v | %v\n  %v\n  Källa: Polisen, %v\n",
+		evt.PublishTime.Local().Format("2006-01-02 15:04"), status,
+		region, evt.Type(), evt.Location(),
+		evt.Description,
+		evt.URL,
+	)
+	return err
+}
+
+func formatJSON(w io.Writer, evt feed.Event) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(evt.Public())
+}
+
+func formatNDJSON(w io.Writer, evt feed.Event) error {
+	return json.NewEncoder(w).Encode(evt.Public())
+}
@@ -0,0 +1,206 @@
+package subscribe
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sebnyberg/policefeed/feed"
+)
+
+const (
+	// maxStreamFailures is the number of consecutive failed connections to a
+	// server before falling back to RSS, when enabled.
+	maxStreamFailures = 3
+	maxStreamBackoff  = time.Minute
+)
+
+// runSubscribeServer prints events streamed from a policefeed server.
+//
+// The cursor of the last printed event is stored in the cursor file, so that
+// the subscription resumes where it left off after a restart.
+func runSubscribeServer(ctx context.Context, conf subscriberConfig, p *printer) error {
+	cursorPath := conf.CursorFile
+	if cursorPath == "" {
+		cacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return fmt.Errorf("find cursor file location err, %w", err)
+		}
+		cursorPath = filepath.Join(cacheDir, "policefeed", "subscribe.cursor")
+	}
+	cursor, err := readCursor(cursorPath)
+	if err != nil {
+		return err
+	}
+	// Events before the cursor, or the since time, are filtered by the server
+	p.started = true
+
+	var failures int
+	var lastPublish time.Time
+	backoff := time.Second
+	for {
+		n, err := streamEvents(ctx, conf.Server, cursor, p.since, func(evt feed.Event, c string) error {
+			if err := p.printEvents([]feed.Event{evt}); err != nil {
+				return err
+			}
+			if evt.PublishTime.After(lastPublish) {
+				lastPublish = evt.PublishTime
+			}
+			cursor = c
+			return writeCursor(cursorPath, cursor)
+		})
+		if ctx.Err() != nil {
+			return nil
+		}
+		var printErr *printError
+		if errors.As(err, &printErr) {
+			return err
+		}
+		if n > 0 {
+			failures, backoff = 0, time.Second
+		}
+		failures++
+		if conf.RSSFallback && failures >= maxStreamFailures {
+			slog.Warn("Server is unavailable, falling back to RSS",
+				"server", conf.Server, "error", err)
+			// The first batch from RSS contains events which were printed
+			// from the stream, or before the subscription started
+			p.restart(lastPublish)
+			return runSubscribeRSS(ctx, conf, p)
+		}
+		slog.Warn("Stream disconnected, reconnecting",
+			"server", conf.Server, "backoff", backoff, "error", err)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxStreamBackoff {
+			backoff = maxStreamBackoff
+		}
+	}
+}
+
+// printError is returned by streamEvents when the callback fails.
+type printError struct {
+	err error
+}
+
+func (e *printError) Error() string { return e.err.Error() }
+
+func (e *printError) Unwrap() error { return e.err }
+
+// streamEvents reads server-sent events from the event stream of the server,
+// calling fn with each event and its cursor. It returns the number of events
+// received before the stream ended.
+func streamEvents(
+	ctx context.Context,
+	serverURL string,
+	cursor string,
+	since time.Time,
+	fn func(evt feed.Event, cursor string) error,
+) (int, error) {
+	u, err := url.Parse(strings.TrimSuffix(serverURL, "/") + "/events/stream")
+	if err != nil {
+		return 0, fmt.Errorf("parse server url, %w", err)
+	}
+	params := url.Values{}
+	if cursor != "" {
+		params.Set("cursor", cursor)
+	} else {
+		params.Set("since", since.UTC().Format(time.RFC3339))
+	}
+	u.RawQuery = params.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return 0, fmt.Errorf("create request, %w", err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("send request, %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected response code %v", resp.StatusCode)
+	}
+
+	var n int
+	var id, data string
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case line == "": // dispatch
+			if data == "" {
+				continue
+			}
+			var public feed.PublicEvent
+			if err := json.Unmarshal([]byte(data), &public); err != nil {
+				return n, fmt.Errorf("parse event, %w", err)
+			}
+			if err := fn(eventFromPublic(public), id); err != nil {
+				return n, &printError{err}
+			}
+			n++
+			id, data = "", ""
+		case strings.HasPrefix(line, "id:"):
+			id = strings.TrimSpace(strings.TrimPrefix(line, "id:"))
+		case strings.HasPrefix(line, "data:"):
+			data += strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return n, err
+	}
+	return n, errors.New("stream closed by server")
+}
+
+// eventFromPublic converts a public event back into an Event. The ID is
+// derived from the URL in the same way as for events from the RSS feed.
+func eventFromPublic(e feed.PublicEvent) feed.Event {
+	return feed.Event{
+		ID:          feed.NewEventID(e.URL),
+		URL:         e.URL,
+		Title:       e.Title,
+		Region:      e.Region,
+		Description: e.Description,
+		Revision:    e.Revision,
+		PublishTime: e.PublishTime,
+		Removed:     e.Status == feed.EventStatusRemoved,
+	}
+}
+
+func readCursor(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("read cursor file err, %w", err)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// writeCursor replaces the contents of the cursor file.
+func writeCursor(path, cursor string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("create cursor dir err, %w", err)
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(cursor+"\n"), 0644); err != nil {
+		return fmt.Errorf("write cursor file err, %w", err)
+	}
+	return os.Rename(tmpPath, path)
+}
@@ -0,0 +1,82 @@
+package subscribe
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sebnyberg/policefeed/feed"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamEvents(t *testing.T) {
+	var gotCursor string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/events/stream", r.URL.Path)
+		gotCursor = r.URL.Query().Get("cursor")
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, ": keep-alive\n\n")
+		fmt.Fprint(w, "id: c1\nevent: event\ndata: {\"url\":\"https://polisen.se/a\",\"revision\":1}\n\n")
+		fmt.Fprint(w, "id: c2\nevent: event\ndata: {\"url\":\"https://polisen.se/b\",\"revision\":2}\n\n")
+	}))
+	defer srv.Close()
+
+	type received struct {
+		url    string
+		cursor string
+	}
+	var got []received
+	n, err := streamEvents(context.Background(), srv.URL+"/", "c0", time.Time{},
+		func(evt feed.Event, cursor string) error {
+			require.Equal(t, feed.NewEventID(evt.URL), evt.ID)
+			got = append(got, received{evt.URL, cursor})
+			return nil
+		},
+	)
+	require.Error(t, err) // the stream was closed by the server
+	require.Equal(t, 2, n)
+	require.Equal(t, "c0", gotCursor)
+	require.Equal(t, []received{
+		{"https://polisen.se/a", "c1"},
+		{"https://polisen.se/b", "c2"},
+	}, got)
+}
+
+func TestStreamEventsRemoved(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "id: c1\nevent: event\ndata: {\"url\":\"https://polisen.se/a\",\"revision\":2,\"status\":\"removed\"}\n\n")
+	}))
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	format, err := newFormatter("text", "")
+	require.NoError(t, err)
+	p := &printer{w: &buf, format: format, started: true}
+	_, err = streamEvents(context.Background(), srv.URL, "", time.Time{},
+		func(evt feed.Event, cursor string) error {
+			require.True(t, evt.Removed)
+			return p.printEvents([]feed.Event{evt})
+		},
+	)
+	require.Error(t, err) // the stream was closed by the server
+	require.Contains(t, buf.String(), "[removed]")
+}
+
+func TestCursorFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policefeed", "subscribe.cursor")
+	cursor, err := readCursor(path)
+	require.NoError(t, err)
+	require.Empty(t, cursor)
+
+	require.NoError(t, writeCursor(path, "c1"))
+	require.NoError(t, writeCursor(path, "c2"))
+	cursor, err = readCursor(path)
+	require.NoError(t, err)
+	require.Equal(t, "c2", cursor)
+}
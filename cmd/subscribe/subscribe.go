@@ -2,12 +2,19 @@ package subscribe
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"log/slog"
 	"os"
 	"os/signal"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/sebnyberg/autodotenv"
 	"github.com/sebnyberg/flagtags"
 	"github.com/sebnyberg/policefeed/feed"
 	"github.com/urfave/cli/v2"
@@ -15,16 +22,31 @@ import (
 )
 
 type subscriberConfig struct {
-	Regions string `value:"" usage:"comma-separated list of region IDs from the Swedish Police Website. If 'all' subscribes to all regions."`
+	Regions     string `value:"" usage:"comma-separated list of region IDs from the Swedish Police Website. If 'all' subscribes to all regions."`
+	Source      string `value:"rss" usage:"event source, 'rss' polls the Police RSS feeds, 'db' tails events created in the policefeed Postgres database"`
+	Since       string `value:"0s" usage:"on start, also print events published within this duration, e.g. '2h', or after this RFC3339 time"`
+	Interval    string `value:"60s" usage:"time between polls of the RSS feeds"`
+	Format      string `value:"text" usage:"output format, one of text,json,ndjson,template"`
+	Template    string `usage:"Go text/template used by the template format, e.g. '{{.Title}} {{.URL}}'"`
+	Server      string `usage:"URL of a policefeed server to stream events from, instead of polling polisen.se"`
+	CursorFile  string `usage:"file that stores the position in the server stream, defaults to a file in the user cache dir"`
+	RSSFallback bool   `name:"rss-fallback" env:"RSS_FALLBACK" usage:"poll polisen.se directly when the server is unavailable"`
+	feed.DBConfig
 }
 
 func NewSubscribeCmd() *cli.Command {
 	var conf subscriberConfig
 
+	if _, err := autodotenv.LoadDotenvIfExists(); err != nil {
+		log.Fatalln(err)
+	}
+
 	return &cli.Command{
-		Name:        "subscribe",
-		Usage:       "subscribe to the police feed",
-		Description: "Subscribe to events occurring on the police feed",
+		Name:  "subscribe",
+		Usage: "subscribe to the police feed",
+		Description: "Subscribe to events occurring on the police feed. New and updated " +
+			"events are printed as they appear, events that have already been " +
+			"printed are never printed again.",
 		Action: func(*cli.Context) error {
 			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
 			defer cancel()
@@ -39,39 +61,181 @@ func NewSubscribeCmd() *cli.Command {
 }
 
 func runSubscribe(ctx context.Context, conf subscriberConfig) error {
-	regionIDs := strings.Split(conf.Regions, ",")
+	since, err := parseSince(conf.Since, time.Now())
+	if err != nil {
+		return err
+	}
+	format, err := newFormatter(conf.Format, conf.Template)
+	if err != nil {
+		return err
+	}
+	p := &printer{w: os.Stdout, format: format, since: since}
+	if conf.Server != "" {
+		if conf.Source == "db" {
+			return errors.New("the db source cannot be combined with a server")
+		}
+		// The stream is not filtered by region
+		if conf.Regions != "" && conf.Regions != "all" {
+			return errors.New("regions cannot be combined with a server")
+		}
+		return runSubscribeServer(ctx, conf, p)
+	}
+	switch conf.Source {
+	case "rss":
+		return runSubscribeRSS(ctx, conf, p)
+	case "db":
+		// The database is not filtered by region
+		if conf.Regions != "" && conf.Regions != "all" {
+			return errors.New("regions cannot be combined with the db source")
+		}
+		return runSubscribeDB(ctx, conf, p)
+	default:
+		return fmt.Errorf("unknown source %q, choose one of rss,db", conf.Source)
+	}
+}
+
+// parseSince parses a duration before now, or an RFC3339 time.
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("since must be a duration or an RFC3339 time, got %q", s)
+	}
+	return t, nil
+}
+
+// runSubscribeRSS polls the RSS feeds and prints new and updated events.
+//
+// Seen events are kept in memory, and the Updater decides which events are
+// new or revised in the same way as for the server.
+func runSubscribeRSS(ctx context.Context, conf subscriberConfig, p *printer) error {
+	interval, err := time.ParseDuration(conf.Interval)
+	if err != nil {
+		return fmt.Errorf("parse interval err, %w", err)
+	}
+	regions := conf.Regions
+	if regions == "all" {
+		regions = ""
+	}
+	rssFeed := feed.NewRSSAdapter(strings.Split(regions, ","), feed.EventsFromRSS)
+	target := &printingStorage{
+		MemoryStorage: feed.NewMemoryStorage(),
+		printer:       p,
+	}
+	up := feed.NewUpdater()
 	for {
-		events, err := feed.EventsFromRSS(ctx, regionIDs)
+		res, err := up.Update(ctx, rssFeed, target)
 		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		ids := make([]string, 0, len(res.FailedRegions))
+		for id := range res.FailedRegions {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			slog.Warn("Fetch region failed", "region", id, "error", res.FailedRegions[id])
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// printingStorage prints created events before adding them to memory.
+type printingStorage struct {
+	*feed.MemoryStorage
+	printer *printer
+}
+
+func (s *printingStorage) CreateEvents(ctx context.Context, events []feed.Event) error {
+	if err := s.MemoryStorage.CreateEvents(ctx, events); err != nil {
+		return err
+	}
+	return s.printer.printEvents(events)
+}
+
+// runSubscribeDB prints events as they are created in the database by a
+// running policefeed server.
+func runSubscribeDB(ctx context.Context, conf subscriberConfig, p *printer) error {
+	db, err := conf.DBConfig.OpenDB()
+	if err != nil {
+		return fmt.Errorf("open database conn err, %w", err)
+	}
+	defer db.Close()
+	listener, err := feed.ListenEvents(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	// Print events in the database that were published since the start time
+	storage := feed.NewEventStorage(db)
+	recent, err := storage.ListLatestEvents(ctx, 500)
+	if err != nil {
+		return fmt.Errorf("list recent events err, %w", err)
+	}
+	if err := p.printEvents(recent); err != nil {
+		return err
+	}
+
+	for evt := range listener.Events() {
+		if err := p.printEvents([]feed.Event{evt}); err != nil {
 			return err
 		}
-		fmt.Printf("Events: %d\n", len(events))
-		time.Sleep(time.Second * 5)
 	}
+	return listener.Err()
+}
+
+// printer prints events that have not already been printed.
+type printer struct {
+	w      io.Writer
+	format formatter
+	// since is the earliest publish time of events printed on start.
+	since   time.Time
+	started bool
+	// printed contains the most recent printed revision of each event.
+	printed map[uuid.UUID]int32
+}
 
+// printEvents prints new and revised events in order of publish time. Only
+// events published after p.since are printed from the first batch, since it
+// contains events published before the subscription started.
+func (p *printer) printEvents(events []feed.Event) error {
+	if p.printed == nil {
+		p.printed = make(map[uuid.UUID]int32)
+	}
+	sorted := append([]feed.Event(nil), events...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].PublishTime.Before(sorted[j].PublishTime)
+	})
+	for _, evt := range sorted {
+		if rev, exists := p.printed[evt.ID]; exists && rev >= evt.Revision {
+			continue
+		}
+		p.printed[evt.ID] = evt.Revision
+		if !p.started && !evt.PublishTime.After(p.since) {
+			continue
+		}
+		if err := p.format(p.w, evt); err != nil {
+			return fmt.Errorf("print event err, %w", err)
+		}
+	}
+	p.started = true
 	return nil
-	// feed.CollectEvents(regions)
-
-	// // Validate regions provided in config
-	// collector, err := feed.NewCollector(
-	// 	strings.Split(conf.Regions, ","),
-	// 	conf.RSSBaseURL,
-	// 	time.Second*1,
-	// 	time.Second*60,
-	// )
-	// if err != nil {
-	// 	return err
-	// }
-
-	// receive, err := collector.Subscribe(ctx)
-	// if err != nil {
-	// 	return err
-	// }
-	// for {
-	// 	evt, err := receive()
-	// 	if err != nil {
-	// 		return err
-	// 	}
-	// 	fmt.Println(evt)
-	// }
+}
+
+// restart treats the next batch as the first batch again, printing only
+// events published after t, or after p.since if it is later.
+func (p *printer) restart(t time.Time) {
+	if t.After(p.since) {
+		p.since = t
+	}
+	p.started = false
 }
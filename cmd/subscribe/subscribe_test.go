@@ -0,0 +1,112 @@
+package subscribe
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sebnyberg/policefeed/feed"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrinter(t *testing.T) {
+	start := time.Date(2022, 2, 9, 12, 0, 0, 0, time.UTC)
+	newEvent := func(url string, revision int32, publishTime time.Time) feed.Event {
+		return feed.Event{
+			ID:          feed.NewEventID(url),
+			URL:         url,
+			Title:       "09 februari 11:00, Brand, Karlskrona",
+			Revision:    revision,
+			PublishTime: publishTime,
+		}
+	}
+	var buf bytes.Buffer
+	format, err := newFormatter("template", "{{.URL}}")
+	require.NoError(t, err)
+	p := &printer{w: &buf, format: format, since: start.Add(-time.Hour)}
+	printed := func() []string {
+		defer buf.Reset()
+		return strings.Fields(buf.String())
+	}
+
+	// Only events published after since are printed on start
+	require.NoError(t, p.printEvents([]feed.Event{
+		newEvent("https://polisen.se/old", 1, start.Add(-2*time.Hour)),
+		newEvent("https://polisen.se/recent", 1, start.Add(-time.Minute)),
+	}))
+	require.Equal(t, []string{"https://polisen.se/recent"}, printed())
+
+	// Afterwards, all new and revised events are printed once
+	require.NoError(t, p.printEvents([]feed.Event{
+		newEvent("https://polisen.se/old", 2, start.Add(-2*time.Hour)),
+		newEvent("https://polisen.se/recent", 1, start.Add(-time.Minute)),
+		newEvent("https://polisen.se/new", 1, start),
+	}))
+	require.Equal(t, []string{"https://polisen.se/old", "https://polisen.se/new"}, printed())
+
+	require.NoError(t, p.printEvents([]feed.Event{
+		newEvent("https://polisen.se/old", 2, start.Add(-2*time.Hour)),
+		newEvent("https://polisen.se/new", 1, start),
+	}))
+	require.Empty(t, printed())
+	// After a restart, only events published after the last printed event
+	// are printed from the first batch
+	p.restart(start)
+	require.NoError(t, p.printEvents([]feed.Event{
+		newEvent("https://polisen.se/missed", 1, start.Add(-time.Minute)),
+		newEvent("https://polisen.se/newer", 1, start.Add(time.Minute)),
+	}))
+	require.Equal(t, []string{"https://polisen.se/newer"}, printed())
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2022, 2, 9, 12, 0, 0, 0, time.UTC)
+	got, err := parseSince("2h", now)
+	require.NoError(t, err)
+	require.Equal(t, now.Add(-2*time.Hour), got)
+
+	got, err = parseSince("2022-02-09T08:00:00Z", now)
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2022, 2, 9, 8, 0, 0, 0, time.UTC), got)
+
+	_, err = parseSince("yesterday", now)
+	require.Error(t, err)
+}
+
+func TestFormat(t *testing.T) {
+	evt := feed.Event{
+		URL:         "https://polisen.se/aktuellt/handelser/2022/februari/9/09-februari-2104-ran-vapnat-solvesborg/",
+		Title:       "09 februari 21:04, Rån väpnat, Sölvesborg",
+		Region:      "Händelser RSS - Blekinge",
+		Description: "Centralt. Personrån utomhus.",
+		Revision:    1,
+		PublishTime: time.Date(2022, 2, 9, 22, 58, 26, 0, time.UTC),
+	}
+	for _, tc := range []struct {
+		format   string
+		template string
+		want     string
+	}{
+		{"text", "", "Källa: Polisen, " + evt.URL + "\n"},
+		{"ndjson", "", `"type":"Rån väpnat","location":"Sölvesborg",` +
+			`"description":"Centralt. Personrån utomhus.","revision":1,` +
+			`"status":"active","publishTime":"2022-02-09T22:58:26Z"}` + "\n"},
+		{"json", "", "  \"revision\": 1,\n  \"status\": \"active\",\n  \"publishTime\": \"2022-02-09T22:58:26Z\"\n}\n"},
+		{"template", "{{.Type}}: {{.URL}}", "Rån väpnat: " + evt.URL + "\n"},
+	} {
+		t.Run(tc.format, func(t *testing.T) {
+			format, err := newFormatter(tc.format, tc.template)
+			require.NoError(t, err)
+			var buf bytes.Buffer
+			require.NoError(t, format(&buf, evt))
+			require.True(t, strings.HasSuffix(buf.String(), tc.want),
+				"want suffix %q, got %q", tc.want, buf.String())
+		})
+	}
+
+	_, err := newFormatter("template", "")
+	require.Error(t, err)
+	_, err = newFormatter("yaml", "")
+	require.Error(t, err)
+}
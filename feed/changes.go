@@ -0,0 +1,99 @@
+package feed
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ChangeCursor is the position of an event revision in the order that
+// revisions are committed to the storage.
+//
+// Seq is assigned by the storage such that a revision committed after a
+// revision has been listed is never ordered before it, even when several
+// processes write concurrently. The event ID and revision order revisions
+// which share a Seq, e.g. revisions created in the same transaction.
+//
+// A cursor returned by StartCursor is instead positioned before the revisions
+// created after a time.
+type ChangeCursor struct {
+	Seq      int64
+	ID       uuid.UUID
+	Revision int32
+	// since is the create time after which a start cursor lists revisions.
+	since time.Time
+}
+
+// StartCursor returns a cursor which is positioned before the revisions
+// created after t. Revisions created after t but committed late may be
+// missed, so streams should continue from the cursor of the listed revisions.
+func StartCursor(t time.Time) ChangeCursor {
+	return ChangeCursor{since: t}
+}
+
+// Since returns the create time after which a start cursor lists revisions,
+// and false if the cursor is not a start cursor.
+func (c ChangeCursor) Since() (time.Time, bool) {
+	return c.since, !c.since.IsZero()
+}
+
+// changeCursorVersion is the first byte of encoded cursors, which tells apart
+// cursors of the current format from cursors ordered by create time.
+const changeCursorVersion = 1
+
+// String returns an opaque representation of the cursor that may be shared
+// outside the service domain. Start cursors can not be represented.
+func (c ChangeCursor) String() string {
+	b := make([]byte, 1+8+16+4)
+	b[0] = changeCursorVersion
+	binary.BigEndian.PutUint64(b[1:], uint64(c.Seq))
+	copy(b[9:], c.ID[:])
+	binary.BigEndian.PutUint32(b[25:], uint32(c.Revision))
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Before reports whether the cursor is ordered before other. Neither cursor
+// may be a start cursor.
+func (c ChangeCursor) Before(other ChangeCursor) bool {
+	if c.Seq != other.Seq {
+		return c.Seq < other.Seq
+	}
+	if cmp := bytes.Compare(c.ID[:], other.ID[:]); cmp != 0 {
+		return cmp < 0
+	}
+	return c.Revision < other.Revision
+}
+
+// ParseChangeCursor parses a cursor returned by ChangeCursor.String.
+func ParseChangeCursor(s string) (ChangeCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) != 1+8+16+4 || b[0] != changeCursorVersion {
+		return ChangeCursor{}, errors.New("invalid cursor")
+	}
+	var c ChangeCursor
+	c.Seq = int64(binary.BigEndian.Uint64(b[1:]))
+	copy(c.ID[:], b[9:25])
+	c.Revision = int32(binary.BigEndian.Uint32(b[25:]))
+	return c, nil
+}
+
+// EventChange is an event revision listed by a ChangeLister.
+type EventChange struct {
+	Event
+	// Cursor is the position of the revision, from which the listing is
+	// resumed.
+	Cursor ChangeCursor
+}
+
+// ChangeLister lists event revisions in the order they were committed.
+type ChangeLister interface {
+	// ListEventChanges lists at most limit event revisions committed after
+	// the cursor, ordered by their cursor. A zero cursor lists all
+	// revisions.
+	ListEventChanges(ctx context.Context, after ChangeCursor, limit int) ([]EventChange, error)
+}
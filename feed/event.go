@@ -1,6 +1,8 @@
 package feed
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -17,14 +19,108 @@ type Event struct {
 	CreateTime      time.Time
 	PublishTime     time.Time
 	ContentHash     []byte
+	// Removed is set on tombstone revisions, which record that the event was
+	// retracted from the RSS feed.
+	Removed bool
+	// FirstSeenTime and LastSeenTime are the times when the event was first
+	// and last seen in the RSS feed. They are shared by all revisions of the
+	// event, and are zero if unknown.
+	FirstSeenTime time.Time
+	LastSeenTime  time.Time
 
 	// Todo: add geometries
 	// EventGeometryRetryTime time.Time // next time to try fetch event geometry
 	// EventGeometry  geom.T
 }
 
+// Type returns the event type given by the title, e.g. "Trafikolycka, vilt"
+// for the title "08 februari 17:35, Trafikolycka, vilt, Karlskrona". If the
+// title does not follow the format, an empty string is returned.
+func (e Event) Type() string {
+	parts := strings.Split(e.Title, ", ")
+	if len(parts) < 3 {
+		return ""
+	}
+	return strings.Join(parts[1:len(parts)-1], ", ")
+}
+
+// Location returns the location given by the title, e.g. "Karlskrona" for
+// the title "08 februari 17:35, Trafikolycka, vilt, Karlskrona". If the title
+// does not follow the format, an empty string is returned.
+func (e Event) Location() string {
+	parts := strings.Split(e.Title, ", ")
+	if len(parts) < 3 {
+		return ""
+	}
+	return parts[len(parts)-1]
+}
+
+// Event statuses, see Event.Status.
+const (
+	EventStatusActive  = "active"
+	EventStatusRemoved = "removed"
+)
+
+// Status returns EventStatusRemoved for tombstone revisions, and
+// EventStatusActive otherwise.
+func (e Event) Status() string {
+	if e.Removed {
+		return EventStatusRemoved
+	}
+	return EventStatusActive
+}
+
 var eventIDNamespace = uuid.NewSHA1(uuid.NameSpaceDNS, []byte("policefeed.v1.PoliceEvent.ID"))
 
 func NewEventID(URL string) uuid.UUID {
 	return uuid.NewSHA1(eventIDNamespace, []byte(URL))
 }
+
+var idempotencyKeyNamespace = uuid.NewSHA1(uuid.NameSpaceDNS, []byte("policefeed.v1.PoliceEvent.IdempotencyKey"))
+
+// IdempotencyKey returns a key that is unique to the revision of the event.
+// Receivers of notifications may use it to discard duplicate deliveries.
+func (e Event) IdempotencyKey() string {
+	return uuid.NewSHA1(
+		idempotencyKeyNamespace,
+		[]byte(fmt.Sprintf("%v/%v", e.ID, e.Revision)),
+	).String()
+}
+
+// PublicEvent is the representation of an Event that is shared outside of the
+// service domain. It leaves out the internal ID and the content hash.
+type PublicEvent struct {
+	URL           string     `json:"url"`
+	Title         string     `json:"title"`
+	Region        string     `json:"region"`
+	Type          string     `json:"type"`
+	Location      string     `json:"location"`
+	Description   string     `json:"description"`
+	Revision      int32      `json:"revision"`
+	Status        string     `json:"status"`
+	PublishTime   time.Time  `json:"publishTime"`
+	FirstSeenTime *time.Time `json:"firstSeenTime,omitempty"`
+	LastSeenTime  *time.Time `json:"lastSeenTime,omitempty"`
+}
+
+// Public returns the public representation of the event.
+func (e Event) Public() PublicEvent {
+	pub := PublicEvent{
+		URL:         e.URL,
+		Title:       e.Title,
+		Region:      e.Region,
+		Type:        e.Type(),
+		Location:    e.Location(),
+		Description: e.Description,
+		Revision:    e.Revision,
+		Status:      e.Status(),
+		PublishTime: e.PublishTime,
+	}
+	if !e.FirstSeenTime.IsZero() {
+		pub.FirstSeenTime = &e.FirstSeenTime
+	}
+	if !e.LastSeenTime.IsZero() {
+		pub.LastSeenTime = &e.LastSeenTime
+	}
+	return pub
+}
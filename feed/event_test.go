@@ -0,0 +1,29 @@
+package feed
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventTitle(t *testing.T) {
+	for _, tc := range []struct {
+		title        string
+		wantType     string
+		wantLocation string
+	}{
+		{"09 februari 21:04, Rån väpnat, Sölvesborg", "Rån väpnat", "Sölvesborg"},
+		{"08 februari 17:35, Trafikolycka, vilt, Karlskrona", "Trafikolycka, vilt", "Karlskrona"},
+		{
+			"Uppdaterad 2022-02-09 08:20:44 09 februari 08:11, Stöld/inbrott, Karlskrona",
+			"Stöld/inbrott", "Karlskrona",
+		},
+		{"Sammanfattning natt", "", ""},
+	} {
+		t.Run(tc.title, func(t *testing.T) {
+			evt := Event{Title: tc.title}
+			require.Equal(t, tc.wantType, evt.Type())
+			require.Equal(t, tc.wantLocation, evt.Location())
+		})
+	}
+}
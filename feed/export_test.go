@@ -0,0 +1,18 @@
+package feed
+
+import "time"
+
+// SetLeaderElectionIntervals shortens the intervals of the leader election
+// in tests.
+func SetLeaderElectionIntervals(l *LeaderElection, retry, check time.Duration) {
+	l.retryInterval = retry
+	l.checkInterval = check
+}
+
+// SetRegionLeaseIntervals shortens the intervals of region leases in tests.
+func SetRegionLeaseIntervals(l *RegionLeases, heartbeat, ttl time.Duration) {
+	l.heartbeatInterval = heartbeat
+	l.ttl = ttl
+}
+
+var AssignRegions = assignRegions
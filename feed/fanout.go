@@ -0,0 +1,232 @@
+package feed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/sync/errgroup"
+)
+
+var _ EventListerCreator = new(FanoutStorage)
+
+var _ LatestEventLister = new(FanoutStorage)
+
+var _ EventSeenMarker = new(FanoutStorage)
+
+// FanoutStorage uses a primary storage for listing and creating events, and
+// mirrors each batch of created events to secondary sinks.
+//
+// Mirroring is asynchronous. A failing or slow mirror never blocks or fails
+// the primary storage. Run must be called for mirrors to deliver events.
+type FanoutStorage struct {
+	primary EventListerCreator
+	mirrors []*Mirror
+}
+
+func NewFanoutStorage(primary EventListerCreator, mirrors ...*Mirror) *FanoutStorage {
+	return &FanoutStorage{
+		primary: primary,
+		mirrors: mirrors,
+	}
+}
+
+// ListUniqueEvents lists events from the primary storage.
+func (s *FanoutStorage) ListUniqueEvents(ctx context.Context, ids []uuid.UUID) ([]Event, error) {
+	return s.primary.ListUniqueEvents(ctx, ids)
+}
+
+// ListLatestEvents lists events from the primary storage.
+func (s *FanoutStorage) ListLatestEvents(ctx context.Context, limit int) ([]Event, error) {
+	lister, ok := s.primary.(LatestEventLister)
+	if !ok {
+		return nil, errors.New("primary storage cannot list latest events")
+	}
+	return lister.ListLatestEvents(ctx, limit)
+}
+
+// MarkEventsSeen marks events as seen in the primary storage. Storages which
+// do not track seen times are left as is.
+func (s *FanoutStorage) MarkEventsSeen(
+	ctx context.Context, ids []uuid.UUID, seenTime time.Time,
+) error {
+	marker, ok := s.primary.(EventSeenMarker)
+	if !ok {
+		return nil
+	}
+	return marker.MarkEventsSeen(ctx, ids, seenTime)
+}
+
+// CreateEvents creates events in the primary storage. Once created, the events
+// are queued for delivery to each mirror.
+func (s *FanoutStorage) CreateEvents(ctx context.Context, events []Event) error {
+	if err := s.primary.CreateEvents(ctx, events); err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	for _, m := range s.mirrors {
+		m.enqueue(ctx, append([]Event(nil), events...))
+	}
+	return nil
+}
+
+// Run delivers queued events to mirrors until the context is cancelled. Events
+// which have not been delivered by then are dead-lettered.
+func (s *FanoutStorage) Run(ctx context.Context) error {
+	g, ctx := errgroup.WithContext(ctx)
+	for _, m := range s.mirrors {
+		m := m
+		g.Go(func() error {
+			return m.run(ctx)
+		})
+	}
+	return g.Wait()
+}
+
+// MirrorConfig configures a Mirror.
+type MirrorConfig struct {
+	// Name identifies the mirror in logs.
+	Name string
+	// Sink receives mirrored events.
+	Sink EventCreator
+	// DeadLetter receives events that could not be delivered to the sink
+	// after MaxAttempts. If nil, undeliverable events are dropped.
+	DeadLetter EventCreator
+	// MaxAttempts is the maximum number of delivery attempts per batch.
+	// Defaults to 5.
+	MaxAttempts int
+	// Backoff is the wait time after the first failed attempt. The wait time
+	// doubles for each subsequent attempt, up to one minute. Defaults to one
+	// second.
+	Backoff time.Duration
+	// QueueSize is the max number of queued batches. When the queue is full,
+	// new batches are sent directly to the dead letter sink. Defaults to 100.
+	QueueSize int
+}
+
+// Mirror delivers batches of events to a secondary sink, with retries and
+// dead-lettering of batches that cannot be delivered.
+type Mirror struct {
+	conf  MirrorConfig
+	queue chan []Event
+}
+
+const (
+	maxMirrorBackoff = time.Minute
+	// mirrorDrainTimeout is the time given to dead-letter undelivered batches
+	// when a mirror stops.
+	mirrorDrainTimeout = 10 * time.Second
+)
+
+func NewMirror(conf MirrorConfig) *Mirror {
+	if conf.MaxAttempts <= 0 {
+		conf.MaxAttempts = 5
+	}
+	if conf.Backoff <= 0 {
+		conf.Backoff = time.Second
+	}
+	if conf.QueueSize <= 0 {
+		conf.QueueSize = 100
+	}
+	return &Mirror{
+		conf:  conf,
+		queue: make(chan []Event, conf.QueueSize),
+	}
+}
+
+func (m *Mirror) enqueue(ctx context.Context, events []Event) {
+	select {
+	case m.queue <- events:
+	default:
+		Logger(ctx).Warn("Mirror queue is full, dead-lettering events",
+			"mirror", m.conf.Name, "count", len(events))
+		m.deadLetter(ctx, events)
+	}
+}
+
+func (m *Mirror) run(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			m.drain(ctx, nil)
+			return nil
+		case events := <-m.queue:
+			if err := m.deliver(ctx, events); err != nil {
+				if ctx.Err() != nil {
+					m.drain(ctx, events)
+					return nil
+				}
+				Logger(ctx).Error("Mirror delivery failed, dead-lettering events",
+					"mirror", m.conf.Name, "count", len(events), "error", err)
+				m.deadLetter(ctx, events)
+			}
+		}
+	}
+}
+
+// drain dead-letters the batch whose delivery was interrupted, if any, and
+// the batches still in the queue, so that no events are lost on shutdown.
+func (m *Mirror) drain(ctx context.Context, interrupted []Event) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), mirrorDrainTimeout)
+	defer cancel()
+	batches := 0
+	if interrupted != nil {
+		m.deadLetter(ctx, interrupted)
+		batches++
+	}
+	for {
+		select {
+		case events := <-m.queue:
+			m.deadLetter(ctx, events)
+			batches++
+		default:
+			if batches > 0 {
+				Logger(ctx).Warn("Mirror stopped, dead-lettered undelivered events",
+					"mirror", m.conf.Name, "batches", batches)
+			}
+			return
+		}
+	}
+}
+
+func (m *Mirror) deliver(ctx context.Context, events []Event) error {
+	backoff := m.conf.Backoff
+	var err error
+	for attempt := 1; attempt <= m.conf.MaxAttempts; attempt++ {
+		if err = m.conf.Sink.CreateEvents(ctx, events); err == nil {
+			return nil
+		}
+		if attempt == m.conf.MaxAttempts {
+			break
+		}
+		Logger(ctx).Warn("Mirror delivery attempt failed",
+			"mirror", m.conf.Name, "attempt", attempt, "max_attempts", m.conf.MaxAttempts,
+			"backoff", backoff, "error", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxMirrorBackoff {
+			backoff = maxMirrorBackoff
+		}
+	}
+	return fmt.Errorf("delivery failed after %d attempts, %w", m.conf.MaxAttempts, err)
+}
+
+func (m *Mirror) deadLetter(ctx context.Context, events []Event) {
+	if m.conf.DeadLetter == nil {
+		Logger(ctx).Error("Mirror has no dead letter sink, dropping events",
+			"mirror", m.conf.Name, "count", len(events))
+		return
+	}
+	if err := m.conf.DeadLetter.CreateEvents(ctx, events); err != nil {
+		Logger(ctx).Error("Mirror dead letter failed, dropping events",
+			"mirror", m.conf.Name, "count", len(events), "error", err)
+	}
+}
@@ -0,0 +1,122 @@
+package feed_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sebnyberg/policefeed/feed"
+	"github.com/sebnyberg/policefeed/feed/feedfakes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFanoutStorage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	primary := feed.NewMemoryStorage()
+	healthy := feed.NewMemoryStorage()
+	failing := new(feedfakes.FakeEventCreator)
+	failing.CreateEventsReturns(errors.New("unavailable"))
+	deadLetter := feed.NewMemoryStorage()
+
+	s := feed.NewFanoutStorage(primary,
+		feed.NewMirror(feed.MirrorConfig{
+			Name: "healthy",
+			Sink: healthy,
+		}),
+		feed.NewMirror(feed.MirrorConfig{
+			Name:        "failing",
+			Sink:        failing,
+			DeadLetter:  deadLetter,
+			MaxAttempts: 3,
+			Backoff:     time.Millisecond,
+		}),
+	)
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+
+	id := feed.NewEventID("https://polisen.se/a")
+	events := []feed.Event{{ID: id, Revision: 1, ContentHash: []byte("a")}}
+	require.NoError(t, s.CreateEvents(ctx, events))
+
+	// The primary storage is written synchronously
+	got, err := s.ListUniqueEvents(ctx, []uuid.UUID{id})
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+
+	// Mirrors are written asynchronously
+	listed := func(s feed.EventLister) func() bool {
+		return func() bool {
+			got, err := s.ListUniqueEvents(ctx, []uuid.UUID{id})
+			return err == nil && len(got) == 1
+		}
+	}
+	require.Eventually(t, listed(healthy), time.Second, time.Millisecond)
+	require.Eventually(t, listed(deadLetter), time.Second, time.Millisecond)
+	require.Equal(t, 3, failing.CreateEventsCallCount())
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestFanoutStorageMarkEventsSeen(t *testing.T) {
+	ctx := context.Background()
+	primary := feed.NewMemoryStorage()
+	s := feed.NewFanoutStorage(primary)
+
+	id := feed.NewEventID("https://polisen.se/a")
+	events := []feed.Event{{ID: id, Revision: 1, ContentHash: []byte("a")}}
+	require.NoError(t, s.CreateEvents(ctx, events))
+
+	seenTime := time.Date(2022, 2, 9, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, s.MarkEventsSeen(ctx, []uuid.UUID{id}, seenTime))
+
+	got, err := primary.ListUniqueEvents(ctx, []uuid.UUID{id})
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	require.True(t, seenTime.Equal(got[0].LastSeenTime))
+
+	// Storages which do not track seen times are left as is
+	s = feed.NewFanoutStorage(new(feedfakes.FakeEventListerCreator))
+	require.NoError(t, s.MarkEventsSeen(ctx, []uuid.UUID{id}, seenTime))
+}
+
+func TestMirrorShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The sink hangs until the mirror stops
+	hanging := new(feedfakes.FakeEventCreator)
+	hanging.CreateEventsStub = func(ctx context.Context, events []feed.Event) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	deadLetter := feed.NewMemoryStorage()
+	s := feed.NewFanoutStorage(feed.NewMemoryStorage(), feed.NewMirror(feed.MirrorConfig{
+		Name:       "hanging",
+		Sink:       hanging,
+		DeadLetter: deadLetter,
+	}))
+
+	var ids []uuid.UUID
+	for _, url := range []string{"https://polisen.se/a", "https://polisen.se/b", "https://polisen.se/c"} {
+		id := feed.NewEventID(url)
+		ids = append(ids, id)
+		require.NoError(t, s.CreateEvents(ctx, []feed.Event{{ID: id, Revision: 1}}))
+	}
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+	require.Eventually(t, func() bool {
+		return hanging.CreateEventsCallCount() == 1
+	}, time.Second, time.Millisecond)
+
+	// Both the interrupted and the queued batches are dead-lettered
+	cancel()
+	require.NoError(t, <-done)
+	got, err := deadLetter.ListUniqueEvents(context.Background(), ids)
+	require.NoError(t, err)
+	require.Len(t, got, 3)
+}
@@ -3,19 +3,96 @@
 package feedpg
 
 import (
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type EventOutbox struct {
+	ID              int64
+	EventID         uuid.UUID
+	Revision        int32
+	IdempotencyKey  string
+	CreateTime      time.Time
+	NextAttemptTime time.Time
+	DeliverTime     sql.NullTime
+	Attempts        int32
+	LastError       sql.NullString
+}
+
+type FeedStatus struct {
+	RegionID    string
+	LastAttempt time.Time
+	LastSuccess sql.NullTime
+	ItemCount   int32
+	LastError   string
+}
+
 type PoliceEvent struct {
-	ID          uuid.UUID
-	Url         string
-	Title       string
-	Region      string
-	Description string
-	PublishTime time.Time
-	CreateTime  time.Time
-	ContentHash []byte
-	Revision    int32
+	ID              uuid.UUID
+	Url             string
+	Title           string
+	Region          string
+	Description     string
+	PublishTime     time.Time
+	CreateTime      time.Time
+	ContentHash     []byte
+	Revision        int32
+	ArticleContents string
+	SearchVector    interface{}
+	Removed         bool
+	ChangeTxid      int64
+}
+
+type PoliceEventArchive struct {
+	ID              uuid.UUID
+	Url             string
+	Title           string
+	Region          string
+	Description     string
+	ArticleContents string
+	PublishTime     time.Time
+	CreateTime      time.Time
+	ContentHash     []byte
+	Revision        int32
+	Removed         bool
+	ArchiveTime     time.Time
+}
+
+type PoliceEventCurrent struct {
+	ID              uuid.UUID
+	Url             string
+	Title           string
+	Region          string
+	Type            string
+	Description     string
+	ArticleContents string
+	PublishTime     time.Time
+	CreateTime      time.Time
+	ContentHash     []byte
+	Revision        int32
+	Removed         bool
+}
+
+type PoliceEventRevision struct {
+	ID       uuid.UUID
+	Revision int32
+}
+
+type PoliceEventSeen struct {
+	ID            uuid.UUID
+	FirstSeenTime time.Time
+	LastSeenTime  time.Time
+}
+
+type RegionLease struct {
+	RegionID   string
+	Owner      string
+	ExpireTime time.Time
+}
+
+type UpdaterReplica struct {
+	ID            string
+	HeartbeatTime time.Time
 }
@@ -1,10 +1,236 @@
 -- name: ListEvents :many
-select *
+select id, url, title, region, description, article_contents, publish_time,
+  create_time, content_hash, revision, removed
 from police_event
 where id = any (@ids::uuid[]);
 
 -- name: ListRecentEvents :many
-select distinct on (id) *
+select c.id, c.url, c.title, c.region, c.description, c.article_contents,
+  c.publish_time, c.create_time, c.content_hash, c.revision, c.removed,
+  s.first_seen_time, s.last_seen_time
+from police_event_current c
+left join police_event_seen s on s.id = c.id
+where c.id = any (@ids::uuid[]);
+
+-- name: ListLatestEvents :many
+select c.id, c.url, c.title, c.region, c.description, c.article_contents,
+  c.publish_time, c.create_time, c.content_hash, c.revision, c.removed,
+  s.first_seen_time, s.last_seen_time
+from police_event_current c
+left join police_event_seen s on s.id = c.id
+order by c.publish_time desc
+limit @max_results::int;
+
+-- name: SearchEvents :many
+select e.id, e.url, e.title, e.region, e.description, e.article_contents,
+  e.publish_time, e.create_time, e.content_hash, e.revision, e.removed,
+  s.first_seen_time, s.last_seen_time,
+  ts_rank_cd(e.search_vector, q)::real as rank,
+  ts_headline(
+    'swedish',
+    e.title || '. ' || e.description || ' ' || e.article_contents,
+    q,
+    @headline_options::text
+  )::text as snippet
+from police_event_current c
+join police_event e
+  on e.id = c.id and e.revision = c.revision and e.publish_time = c.publish_time
+left join police_event_seen s on s.id = e.id,
+  websearch_to_tsquery('swedish', @query::text) q
+where e.search_vector @@ q
+order by rank desc, e.publish_time desc
+limit @max_results::int;
+
+-- name: ClaimOutboxEvents :many
+with claimed as (
+  update event_outbox o
+  set next_attempt_time = now() + make_interval(secs => @claim_seconds::float8)
+  where o.id in (
+    select p.id
+    from event_outbox p
+    where p.deliver_time is null
+      and p.next_attempt_time <= now()
+    order by p.id
+    limit @max_results::int
+    for update skip locked
+  )
+  returning o.id, o.event_id, o.revision, o.idempotency_key, o.attempts
+)
+select c.id as outbox_id, c.idempotency_key, c.attempts,
+  e.id, e.url, e.title, e.region, e.description, e.article_contents,
+  e.publish_time, e.create_time, e.content_hash, e.revision, e.removed
+from claimed c
+join police_event e on e.id = c.event_id and e.revision = c.revision
+order by c.id;
+
+-- name: MarkOutboxDelivered :exec
+update event_outbox
+set deliver_time = now(),
+  attempts = attempts + 1,
+  last_error = null
+where id = any (@ids::bigint[]);
+
+-- name: MarkOutboxFailed :exec
+update event_outbox
+set attempts = attempts + 1,
+  next_attempt_time = now() + least(
+    interval '1 second' * power(2, attempts),
+    interval '1 hour'
+  ),
+  last_error = @last_error::text
+where id = any (@ids::bigint[]);
+
+-- name: DeleteDeliveredOutbox :execrows
+delete from event_outbox
+where deliver_time < @before::timestamptz;
+
+-- name: DeleteUndeliveredOutbox :execrows
+delete from event_outbox
+where deliver_time is null
+  and create_time < @before::timestamptz;
+
+-- name: GetEvent :one
+select id, url, title, region, description, article_contents, publish_time,
+  create_time, content_hash, revision, removed
+from police_event
+where id = @id and revision = @revision;
+
+-- name: ListEventChanges :many
+select id, url, title, region, description, article_contents, publish_time,
+  create_time, content_hash, revision, removed, change_txid
+from police_event
+where (change_txid, id, revision) > (@change_txid::bigint, @id::uuid, @revision::int)
+  and change_txid < txid_snapshot_xmin(txid_current_snapshot())
+order by change_txid, id, revision
+limit @max_results::int;
+
+-- name: ListEventChangesSince :many
+select id, url, title, region, description, article_contents, publish_time,
+  create_time, content_hash, revision, removed, change_txid
 from police_event
-where id = any (@ids::uuid[])
-order by id, revision desc;
+where create_time > @since::timestamptz
+  and change_txid < txid_snapshot_xmin(txid_current_snapshot())
+order by change_txid, id, revision
+limit @max_results::int;
+
+-- name: MarkEventsSeen :exec
+insert into police_event_seen (id, first_seen_time, last_seen_time)
+select id, @seen_time::timestamptz, @seen_time::timestamptz
+from unnest(@ids::uuid[]) as id
+on conflict (id) do update
+set last_seen_time = greatest(police_event_seen.last_seen_time, excluded.last_seen_time);
+
+-- name: HeartbeatReplica :exec
+insert into updater_replica (id, heartbeat_time)
+values (@id, now())
+on conflict (id) do update
+set heartbeat_time = excluded.heartbeat_time;
+
+-- name: ListLiveReplicas :many
+select id
+from updater_replica
+where heartbeat_time > now() - make_interval(secs => @ttl_seconds::float8)
+order by id;
+
+-- name: DeleteReplica :exec
+delete from updater_replica
+where id = @id;
+
+-- name: ClaimRegionLeases :many
+insert into region_lease (region_id, owner, expire_time)
+select region_id, @owner::text, now() + make_interval(secs => @ttl_seconds::float8)
+from unnest(@region_ids::text[]) as region_id
+on conflict (region_id) do update
+set owner = excluded.owner,
+  expire_time = excluded.expire_time
+where region_lease.owner = excluded.owner
+  or region_lease.expire_time < now()
+returning region_id;
+
+-- name: ReleaseRegionLeases :exec
+delete from region_lease
+where owner = @owner::text
+  and not (region_id = any (@keep::text[]));
+
+-- name: CountRegionLeases :one
+select count(*)::int
+from region_lease
+where owner = @owner::text
+  and region_id = any (@region_ids::text[])
+  and expire_time > now();
+
+-- name: ListArchivableRevisions :many
+select e.region, count(distinct e.id)::int as events, count(*)::int as revisions
+from police_event e
+where e.create_time < @before::timestamptz
+  and exists (
+    select 1 from police_event f where f.id = e.id and f.revision < e.revision
+  )
+  and exists (
+    select 1 from police_event l where l.id = e.id and l.revision > e.revision
+  )
+  and not exists (
+    select 1 from event_outbox o
+    where o.event_id = e.id and o.revision = e.revision
+      and o.deliver_time is null
+  )
+  and not exists (
+    select 1 from police_event_seen s
+    where s.id = e.id and s.last_seen_time >= @before::timestamptz
+  )
+group by e.region
+order by e.region;
+
+-- name: ArchiveEventRevisions :many
+with archived as (
+  delete from police_event e
+  where (e.id, e.revision) in (
+    select c.id, c.revision
+    from police_event c
+    where c.create_time < @before::timestamptz
+      and exists (
+        select 1 from police_event f where f.id = c.id and f.revision < c.revision
+      )
+      and exists (
+        select 1 from police_event l where l.id = c.id and l.revision > c.revision
+      )
+      and not exists (
+        select 1 from event_outbox o
+        where o.event_id = c.id and o.revision = c.revision
+          and o.deliver_time is null
+      )
+      and not exists (
+        select 1 from police_event_seen s
+        where s.id = c.id and s.last_seen_time >= @before::timestamptz
+      )
+    limit @max_rows::int
+    for update skip locked
+  )
+  returning e.id, e.url, e.title, e.region, e.description, e.article_contents,
+    e.publish_time, e.create_time, e.content_hash, e.revision, e.removed
+)
+insert into police_event_archive (id, url, title, region, description,
+  article_contents, publish_time, create_time, content_hash, revision, removed)
+select id, url, title, region, description, article_contents, publish_time,
+  create_time, content_hash, revision, removed
+from archived
+returning id, region;
+
+-- name: ListFeedStatuses :many
+select * from feed_status
+order by region_id;
+
+-- name: UpsertFeedStatus :exec
+insert into feed_status (region_id, last_attempt, last_success, item_count, last_error)
+values (@region_id, @last_attempt, @last_success, @item_count, @last_error)
+on conflict (region_id) do update
+set last_attempt = excluded.last_attempt,
+  item_count = case
+    when feed_status.last_success is null
+      or excluded.last_success > feed_status.last_success
+    then excluded.item_count
+    else feed_status.item_count
+  end,
+  last_success = greatest(feed_status.last_success, excluded.last_success),
+  last_error = excluded.last_error
+where feed_status.last_attempt < excluded.last_attempt;
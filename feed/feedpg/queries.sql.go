@@ -5,36 +5,657 @@ package feedpg
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/lib/pq"
 	"github.com/google/uuid"
 )
 
+const archiveEventRevisions = `-- name: ArchiveEventRevisions :many
+with archived as (
+  delete from police_event e
+  where (e.id, e.revision) in (
+    select c.id, c.revision
+    from police_event c
+    where c.create_time < $1::timestamptz
+      and exists (
+        select 1 from police_event f where f.id = c.id and f.revision < c.revision
+      )
+      and exists (
+        select 1 from police_event l where l.id = c.id and l.revision > c.revision
+      )
+      and not exists (
+        select 1 from event_outbox o
+        where o.event_id = c.id and o.revision = c.revision
+          and o.deliver_time is null
+      )
+      and not exists (
+        select 1 from police_event_seen s
+        where s.id = c.id and s.last_seen_time >= $1::timestamptz
+      )
+    limit $2::int
+    for update skip locked
+  )
+  returning e.id, e.url, e.title, e.region, e.description, e.article_contents,
+    e.publish_time, e.create_time, e.content_hash, e.revision, e.removed
+)
+insert into police_event_archive (id, url, title, region, description,
+  article_contents, publish_time, create_time, content_hash, revision, removed)
+select id, url, title, region, description, article_contents, publish_time,
+  create_time, content_hash, revision, removed
+from archived
+returning id, region
+`
+
+type ArchiveEventRevisionsParams struct {
+	Before  time.Time
+	MaxRows int32
+}
+
+type ArchiveEventRevisionsRow struct {
+	ID     uuid.UUID
+	Region string
+}
+
+func (q *Queries) ArchiveEventRevisions(ctx context.Context, arg ArchiveEventRevisionsParams) ([]ArchiveEventRevisionsRow, error) {
+	rows, err := q.db.QueryContext(ctx, archiveEventRevisions, arg.Before, arg.MaxRows)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ArchiveEventRevisionsRow
+	for rows.Next() {
+		var i ArchiveEventRevisionsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Region,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const claimOutboxEvents = `-- name: ClaimOutboxEvents :many
+with claimed as (
+  update event_outbox o
+  set next_attempt_time = now() + make_interval(secs => $1::float8)
+  where o.id in (
+    select p.id
+    from event_outbox p
+    where p.deliver_time is null
+      and p.next_attempt_time <= now()
+    order by p.id
+    limit $2::int
+    for update skip locked
+  )
+  returning o.id, o.event_id, o.revision, o.idempotency_key, o.attempts
+)
+select c.id as outbox_id, c.idempotency_key, c.attempts,
+  e.id, e.url, e.title, e.region, e.description, e.article_contents,
+  e.publish_time, e.create_time, e.content_hash, e.revision, e.removed
+from claimed c
+join police_event e on e.id = c.event_id and e.revision = c.revision
+order by c.id
+`
+
+type ClaimOutboxEventsParams struct {
+	ClaimSeconds float64
+	MaxResults   int32
+}
+
+type ClaimOutboxEventsRow struct {
+	OutboxID        int64
+	IdempotencyKey  string
+	Attempts        int32
+	ID              uuid.UUID
+	Url             string
+	Title           string
+	Region          string
+	Description     string
+	ArticleContents string
+	PublishTime     time.Time
+	CreateTime      time.Time
+	ContentHash     []byte
+	Revision        int32
+	Removed         bool
+}
+
+func (q *Queries) ClaimOutboxEvents(ctx context.Context, arg ClaimOutboxEventsParams) ([]ClaimOutboxEventsRow, error) {
+	rows, err := q.db.QueryContext(ctx, claimOutboxEvents, arg.ClaimSeconds, arg.MaxResults)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ClaimOutboxEventsRow
+	for rows.Next() {
+		var i ClaimOutboxEventsRow
+		if err := rows.Scan(
+			&i.OutboxID,
+			&i.IdempotencyKey,
+			&i.Attempts,
+			&i.ID,
+			&i.Url,
+			&i.Title,
+			&i.Region,
+			&i.Description,
+			&i.ArticleContents,
+			&i.PublishTime,
+			&i.CreateTime,
+			&i.ContentHash,
+			&i.Revision,
+			&i.Removed,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const claimRegionLeases = `-- name: ClaimRegionLeases :many
+insert into region_lease (region_id, owner, expire_time)
+select region_id, $1::text, now() + make_interval(secs => $2::float8)
+from unnest($3::text[]) as region_id
+on conflict (region_id) do update
+set owner = excluded.owner,
+  expire_time = excluded.expire_time
+where region_lease.owner = excluded.owner
+  or region_lease.expire_time < now()
+returning region_id
+`
+
+type ClaimRegionLeasesParams struct {
+	Owner      string
+	TtlSeconds float64
+	RegionIds  []string
+}
+
+func (q *Queries) ClaimRegionLeases(ctx context.Context, arg ClaimRegionLeasesParams) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, claimRegionLeases, arg.Owner, arg.TtlSeconds, pq.Array(arg.RegionIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var region_id string
+		if err := rows.Scan(&region_id); err != nil {
+			return nil, err
+		}
+		items = append(items, region_id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const countRegionLeases = `-- name: CountRegionLeases :one
+select count(*)::int
+from region_lease
+where owner = $1::text
+  and region_id = any ($2::text[])
+  and expire_time > now()
+`
+
+type CountRegionLeasesParams struct {
+	Owner     string
+	RegionIds []string
+}
+
+func (q *Queries) CountRegionLeases(ctx context.Context, arg CountRegionLeasesParams) (int32, error) {
+	row := q.db.QueryRowContext(ctx, countRegionLeases, arg.Owner, pq.Array(arg.RegionIds))
+	var column_1 int32
+	err := row.Scan(&column_1)
+	return column_1, err
+}
+
+const deleteDeliveredOutbox = `-- name: DeleteDeliveredOutbox :execrows
+delete from event_outbox
+where deliver_time < $1::timestamptz
+`
+
+func (q *Queries) DeleteDeliveredOutbox(ctx context.Context, before time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteDeliveredOutbox, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteReplica = `-- name: DeleteReplica :exec
+delete from updater_replica
+where id = $1
+`
+
+func (q *Queries) DeleteReplica(ctx context.Context, id string) error {
+	_, err := q.db.ExecContext(ctx, deleteReplica, id)
+	return err
+}
+
+const deleteUndeliveredOutbox = `-- name: DeleteUndeliveredOutbox :execrows
+delete from event_outbox
+where deliver_time is null
+  and create_time < $1::timestamptz
+`
+
+func (q *Queries) DeleteUndeliveredOutbox(ctx context.Context, before time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteUndeliveredOutbox, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getEvent = `-- name: GetEvent :one
+select id, url, title, region, description, article_contents, publish_time,
+  create_time, content_hash, revision, removed
+from police_event
+where id = $1 and revision = $2
+`
+
+type GetEventParams struct {
+	ID       uuid.UUID
+	Revision int32
+}
+
+type GetEventRow struct {
+	ID              uuid.UUID
+	Url             string
+	Title           string
+	Region          string
+	Description     string
+	ArticleContents string
+	PublishTime     time.Time
+	CreateTime      time.Time
+	ContentHash     []byte
+	Revision        int32
+	Removed         bool
+}
+
+func (q *Queries) GetEvent(ctx context.Context, arg GetEventParams) (GetEventRow, error) {
+	row := q.db.QueryRowContext(ctx, getEvent, arg.ID, arg.Revision)
+	var i GetEventRow
+	err := row.Scan(
+		&i.ID,
+		&i.Url,
+		&i.Title,
+		&i.Region,
+		&i.Description,
+		&i.ArticleContents,
+		&i.PublishTime,
+		&i.CreateTime,
+		&i.ContentHash,
+		&i.Revision,
+		&i.Removed,
+	)
+	return i, err
+}
+
+const heartbeatReplica = `-- name: HeartbeatReplica :exec
+insert into updater_replica (id, heartbeat_time)
+values ($1, now())
+on conflict (id) do update
+set heartbeat_time = excluded.heartbeat_time
+`
+
+func (q *Queries) HeartbeatReplica(ctx context.Context, id string) error {
+	_, err := q.db.ExecContext(ctx, heartbeatReplica, id)
+	return err
+}
+
+const listArchivableRevisions = `-- name: ListArchivableRevisions :many
+select e.region, count(distinct e.id)::int as events, count(*)::int as revisions
+from police_event e
+where e.create_time < $1::timestamptz
+  and exists (
+    select 1 from police_event f where f.id = e.id and f.revision < e.revision
+  )
+  and exists (
+    select 1 from police_event l where l.id = e.id and l.revision > e.revision
+  )
+  and not exists (
+    select 1 from event_outbox o
+    where o.event_id = e.id and o.revision = e.revision
+      and o.deliver_time is null
+  )
+  and not exists (
+    select 1 from police_event_seen s
+    where s.id = e.id and s.last_seen_time >= $1::timestamptz
+  )
+group by e.region
+order by e.region
+`
+
+type ListArchivableRevisionsRow struct {
+	Region    string
+	Events    int32
+	Revisions int32
+}
+
+func (q *Queries) ListArchivableRevisions(ctx context.Context, before time.Time) ([]ListArchivableRevisionsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listArchivableRevisions, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListArchivableRevisionsRow
+	for rows.Next() {
+		var i ListArchivableRevisionsRow
+		if err := rows.Scan(
+			&i.Region,
+			&i.Events,
+			&i.Revisions,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listEventChanges = `-- name: ListEventChanges :many
+select id, url, title, region, description, article_contents, publish_time,
+  create_time, content_hash, revision, removed, change_txid
+from police_event
+where (change_txid, id, revision) > ($1::bigint, $2::uuid, $3::int)
+  and change_txid < txid_snapshot_xmin(txid_current_snapshot())
+order by change_txid, id, revision
+limit $4::int
+`
+
+type ListEventChangesParams struct {
+	ChangeTxid int64
+	ID         uuid.UUID
+	Revision   int32
+	MaxResults int32
+}
+
+type ListEventChangesRow struct {
+	ID              uuid.UUID
+	Url             string
+	Title           string
+	Region          string
+	Description     string
+	ArticleContents string
+	PublishTime     time.Time
+	CreateTime      time.Time
+	ContentHash     []byte
+	Revision        int32
+	Removed         bool
+	ChangeTxid      int64
+}
+
+func (q *Queries) ListEventChanges(ctx context.Context, arg ListEventChangesParams) ([]ListEventChangesRow, error) {
+	rows, err := q.db.QueryContext(ctx, listEventChanges,
+		arg.ChangeTxid,
+		arg.ID,
+		arg.Revision,
+		arg.MaxResults,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListEventChangesRow
+	for rows.Next() {
+		var i ListEventChangesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Url,
+			&i.Title,
+			&i.Region,
+			&i.Description,
+			&i.ArticleContents,
+			&i.PublishTime,
+			&i.CreateTime,
+			&i.ContentHash,
+			&i.Revision,
+			&i.Removed,
+			&i.ChangeTxid,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listEventChangesSince = `-- name: ListEventChangesSince :many
+select id, url, title, region, description, article_contents, publish_time,
+  create_time, content_hash, revision, removed, change_txid
+from police_event
+where create_time > $1::timestamptz
+  and change_txid < txid_snapshot_xmin(txid_current_snapshot())
+order by change_txid, id, revision
+limit $2::int
+`
+
+type ListEventChangesSinceParams struct {
+	Since      time.Time
+	MaxResults int32
+}
+
+type ListEventChangesSinceRow struct {
+	ID              uuid.UUID
+	Url             string
+	Title           string
+	Region          string
+	Description     string
+	ArticleContents string
+	PublishTime     time.Time
+	CreateTime      time.Time
+	ContentHash     []byte
+	Revision        int32
+	Removed         bool
+	ChangeTxid      int64
+}
+
+func (q *Queries) ListEventChangesSince(ctx context.Context, arg ListEventChangesSinceParams) ([]ListEventChangesSinceRow, error) {
+	rows, err := q.db.QueryContext(ctx, listEventChangesSince, arg.Since, arg.MaxResults)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListEventChangesSinceRow
+	for rows.Next() {
+		var i ListEventChangesSinceRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Url,
+			&i.Title,
+			&i.Region,
+			&i.Description,
+			&i.ArticleContents,
+			&i.PublishTime,
+			&i.CreateTime,
+			&i.ContentHash,
+			&i.Revision,
+			&i.Removed,
+			&i.ChangeTxid,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listEvents = `-- name: ListEvents :many
-select id, url, title, region, description, publish_time, create_time, content_hash, revision
+select id, url, title, region, description, article_contents, publish_time,
+  create_time, content_hash, revision, removed
 from police_event
 where id = any ($1::uuid[])
 `
 
-func (q *Queries) ListEvents(ctx context.Context, ids []uuid.UUID) ([]PoliceEvent, error) {
+type ListEventsRow struct {
+	ID              uuid.UUID
+	Url             string
+	Title           string
+	Region          string
+	Description     string
+	ArticleContents string
+	PublishTime     time.Time
+	CreateTime      time.Time
+	ContentHash     []byte
+	Revision        int32
+	Removed         bool
+}
+
+func (q *Queries) ListEvents(ctx context.Context, ids []uuid.UUID) ([]ListEventsRow, error) {
 	rows, err := q.db.QueryContext(ctx, listEvents, pq.Array(ids))
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []PoliceEvent
+	var items []ListEventsRow
+	for rows.Next() {
+		var i ListEventsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Url,
+			&i.Title,
+			&i.Region,
+			&i.Description,
+			&i.ArticleContents,
+			&i.PublishTime,
+			&i.CreateTime,
+			&i.ContentHash,
+			&i.Revision,
+			&i.Removed,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listFeedStatuses = `-- name: ListFeedStatuses :many
+select region_id, last_attempt, last_success, item_count, last_error from feed_status
+order by region_id
+`
+
+func (q *Queries) ListFeedStatuses(ctx context.Context) ([]FeedStatus, error) {
+	rows, err := q.db.QueryContext(ctx, listFeedStatuses)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []FeedStatus
+	for rows.Next() {
+		var i FeedStatus
+		if err := rows.Scan(
+			&i.RegionID,
+			&i.LastAttempt,
+			&i.LastSuccess,
+			&i.ItemCount,
+			&i.LastError,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listLatestEvents = `-- name: ListLatestEvents :many
+select c.id, c.url, c.title, c.region, c.description, c.article_contents,
+  c.publish_time, c.create_time, c.content_hash, c.revision, c.removed,
+  s.first_seen_time, s.last_seen_time
+from police_event_current c
+left join police_event_seen s on s.id = c.id
+order by c.publish_time desc
+limit $1::int
+`
+
+type ListLatestEventsRow struct {
+	ID              uuid.UUID
+	Url             string
+	Title           string
+	Region          string
+	Description     string
+	ArticleContents string
+	PublishTime     time.Time
+	CreateTime      time.Time
+	ContentHash     []byte
+	Revision        int32
+	Removed         bool
+	FirstSeenTime   sql.NullTime
+	LastSeenTime    sql.NullTime
+}
+
+func (q *Queries) ListLatestEvents(ctx context.Context, maxResults int32) ([]ListLatestEventsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listLatestEvents, maxResults)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListLatestEventsRow
 	for rows.Next() {
-		var i PoliceEvent
+		var i ListLatestEventsRow
 		if err := rows.Scan(
 			&i.ID,
 			&i.Url,
 			&i.Title,
 			&i.Region,
 			&i.Description,
+			&i.ArticleContents,
 			&i.PublishTime,
 			&i.CreateTime,
 			&i.ContentHash,
 			&i.Revision,
+			&i.Removed,
+			&i.FirstSeenTime,
+			&i.LastSeenTime,
 		); err != nil {
 			return nil, err
 		}
@@ -49,32 +670,236 @@ func (q *Queries) ListEvents(ctx context.Context, ids []uuid.UUID) ([]PoliceEven
 	return items, nil
 }
 
+const listLiveReplicas = `-- name: ListLiveReplicas :many
+select id
+from updater_replica
+where heartbeat_time > now() - make_interval(secs => $1::float8)
+order by id
+`
+
+func (q *Queries) ListLiveReplicas(ctx context.Context, ttlSeconds float64) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, listLiveReplicas, ttlSeconds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listRecentEvents = `-- name: ListRecentEvents :many
-select distinct on (id) id, url, title, region, description, publish_time, create_time, content_hash, revision
-from police_event
-where id = any ($1::uuid[])
-order by id, revision desc
+select c.id, c.url, c.title, c.region, c.description, c.article_contents,
+  c.publish_time, c.create_time, c.content_hash, c.revision, c.removed,
+  s.first_seen_time, s.last_seen_time
+from police_event_current c
+left join police_event_seen s on s.id = c.id
+where c.id = any ($1::uuid[])
 `
 
-func (q *Queries) ListRecentEvents(ctx context.Context, ids []uuid.UUID) ([]PoliceEvent, error) {
+type ListRecentEventsRow struct {
+	ID              uuid.UUID
+	Url             string
+	Title           string
+	Region          string
+	Description     string
+	ArticleContents string
+	PublishTime     time.Time
+	CreateTime      time.Time
+	ContentHash     []byte
+	Revision        int32
+	Removed         bool
+	FirstSeenTime   sql.NullTime
+	LastSeenTime    sql.NullTime
+}
+
+func (q *Queries) ListRecentEvents(ctx context.Context, ids []uuid.UUID) ([]ListRecentEventsRow, error) {
 	rows, err := q.db.QueryContext(ctx, listRecentEvents, pq.Array(ids))
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []PoliceEvent
+	var items []ListRecentEventsRow
+	for rows.Next() {
+		var i ListRecentEventsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Url,
+			&i.Title,
+			&i.Region,
+			&i.Description,
+			&i.ArticleContents,
+			&i.PublishTime,
+			&i.CreateTime,
+			&i.ContentHash,
+			&i.Revision,
+			&i.Removed,
+			&i.FirstSeenTime,
+			&i.LastSeenTime,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markEventsSeen = `-- name: MarkEventsSeen :exec
+insert into police_event_seen (id, first_seen_time, last_seen_time)
+select id, $1::timestamptz, $1::timestamptz
+from unnest($2::uuid[]) as id
+on conflict (id) do update
+set last_seen_time = greatest(police_event_seen.last_seen_time, excluded.last_seen_time)
+`
+
+type MarkEventsSeenParams struct {
+	SeenTime time.Time
+	Ids      []uuid.UUID
+}
+
+func (q *Queries) MarkEventsSeen(ctx context.Context, arg MarkEventsSeenParams) error {
+	_, err := q.db.ExecContext(ctx, markEventsSeen, arg.SeenTime, pq.Array(arg.Ids))
+	return err
+}
+
+const markOutboxDelivered = `-- name: MarkOutboxDelivered :exec
+update event_outbox
+set deliver_time = now(),
+  attempts = attempts + 1,
+  last_error = null
+where id = any ($1::bigint[])
+`
+
+func (q *Queries) MarkOutboxDelivered(ctx context.Context, ids []int64) error {
+	_, err := q.db.ExecContext(ctx, markOutboxDelivered, pq.Array(ids))
+	return err
+}
+
+const markOutboxFailed = `-- name: MarkOutboxFailed :exec
+update event_outbox
+set attempts = attempts + 1,
+  next_attempt_time = now() + least(
+    interval '1 second' * power(2, attempts),
+    interval '1 hour'
+  ),
+  last_error = $1::text
+where id = any ($2::bigint[])
+`
+
+type MarkOutboxFailedParams struct {
+	LastError string
+	Ids       []int64
+}
+
+func (q *Queries) MarkOutboxFailed(ctx context.Context, arg MarkOutboxFailedParams) error {
+	_, err := q.db.ExecContext(ctx, markOutboxFailed, arg.LastError, pq.Array(arg.Ids))
+	return err
+}
+
+const releaseRegionLeases = `-- name: ReleaseRegionLeases :exec
+delete from region_lease
+where owner = $1::text
+  and not (region_id = any ($2::text[]))
+`
+
+type ReleaseRegionLeasesParams struct {
+	Owner string
+	Keep  []string
+}
+
+func (q *Queries) ReleaseRegionLeases(ctx context.Context, arg ReleaseRegionLeasesParams) error {
+	_, err := q.db.ExecContext(ctx, releaseRegionLeases, arg.Owner, pq.Array(arg.Keep))
+	return err
+}
+
+const searchEvents = `-- name: SearchEvents :many
+select e.id, e.url, e.title, e.region, e.description, e.article_contents,
+  e.publish_time, e.create_time, e.content_hash, e.revision, e.removed,
+  s.first_seen_time, s.last_seen_time,
+  ts_rank_cd(e.search_vector, q)::real as rank,
+  ts_headline(
+    'swedish',
+    e.title || '. ' || e.description || ' ' || e.article_contents,
+    q,
+    $1::text
+  )::text as snippet
+from police_event_current c
+join police_event e
+  on e.id = c.id and e.revision = c.revision and e.publish_time = c.publish_time
+left join police_event_seen s on s.id = e.id,
+  websearch_to_tsquery('swedish', $2::text) q
+where e.search_vector @@ q
+order by rank desc, e.publish_time desc
+limit $3::int
+`
+
+type SearchEventsParams struct {
+	HeadlineOptions string
+	Query           string
+	MaxResults      int32
+}
+
+type SearchEventsRow struct {
+	ID              uuid.UUID
+	Url             string
+	Title           string
+	Region          string
+	Description     string
+	ArticleContents string
+	PublishTime     time.Time
+	CreateTime      time.Time
+	ContentHash     []byte
+	Revision        int32
+	Removed         bool
+	FirstSeenTime   sql.NullTime
+	LastSeenTime    sql.NullTime
+	Rank            float32
+	Snippet         string
+}
+
+func (q *Queries) SearchEvents(ctx context.Context, arg SearchEventsParams) ([]SearchEventsRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchEvents, arg.HeadlineOptions, arg.Query, arg.MaxResults)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchEventsRow
 	for rows.Next() {
-		var i PoliceEvent
+		var i SearchEventsRow
 		if err := rows.Scan(
 			&i.ID,
 			&i.Url,
 			&i.Title,
 			&i.Region,
 			&i.Description,
+			&i.ArticleContents,
 			&i.PublishTime,
 			&i.CreateTime,
 			&i.ContentHash,
 			&i.Revision,
+			&i.Removed,
+			&i.FirstSeenTime,
+			&i.LastSeenTime,
+			&i.Rank,
+			&i.Snippet,
 		); err != nil {
 			return nil, err
 		}
@@ -88,3 +913,38 @@ func (q *Queries) ListRecentEvents(ctx context.Context, ids []uuid.UUID) ([]Poli
 	}
 	return items, nil
 }
+
+const upsertFeedStatus = `-- name: UpsertFeedStatus :exec
+insert into feed_status (region_id, last_attempt, last_success, item_count, last_error)
+values ($1, $2, $3, $4, $5)
+on conflict (region_id) do update
+set last_attempt = excluded.last_attempt,
+  item_count = case
+    when feed_status.last_success is null
+      or excluded.last_success > feed_status.last_success
+    then excluded.item_count
+    else feed_status.item_count
+  end,
+  last_success = greatest(feed_status.last_success, excluded.last_success),
+  last_error = excluded.last_error
+where feed_status.last_attempt < excluded.last_attempt
+`
+
+type UpsertFeedStatusParams struct {
+	RegionID    string
+	LastAttempt time.Time
+	LastSuccess sql.NullTime
+	ItemCount   int32
+	LastError   string
+}
+
+func (q *Queries) UpsertFeedStatus(ctx context.Context, arg UpsertFeedStatusParams) error {
+	_, err := q.db.ExecContext(ctx, upsertFeedStatus,
+		arg.RegionID,
+		arg.LastAttempt,
+		arg.LastSuccess,
+		arg.ItemCount,
+		arg.LastError,
+	)
+	return err
+}
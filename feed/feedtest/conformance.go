@@ -0,0 +1,306 @@
+// Package feedtest contains a conformance test suite for storage backends.
+package feedtest
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sebnyberg/policefeed/feed"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEventListerCreator runs the conformance test suite against storage
+// created by newStorage. Each test creates its own storage, which is expected
+// to be empty.
+func TestEventListerCreator(
+	t *testing.T,
+	newStorage func(t *testing.T) feed.EventListerCreator,
+) {
+	ctx := context.Background()
+	baseT := time.Date(2022, 2, 9, 8, 0, 0, 0, time.UTC)
+
+	t.Run("list empty", func(t *testing.T) {
+		s := newStorage(t)
+		got, err := s.ListUniqueEvents(ctx, []uuid.UUID{newID(1)})
+		require.NoError(t, err)
+		require.Empty(t, got)
+	})
+
+	t.Run("create and list", func(t *testing.T) {
+		s := newStorage(t)
+		want := []feed.Event{
+			newEvent(1, 1, "a", baseT),
+			newEvent(2, 1, "b", baseT.Add(time.Minute)),
+		}
+		want[0].ArticleContents = "Polisen larmades strax efter klockan åtta."
+		require.NoError(t, s.CreateEvents(ctx, want))
+
+		got, err := s.ListUniqueEvents(ctx, []uuid.UUID{newID(1), newID(2), newID(3)})
+		require.NoError(t, err)
+		requireEvents(t, want, got)
+
+		got, err = s.ListUniqueEvents(ctx, []uuid.UUID{newID(2)})
+		require.NoError(t, err)
+		requireEvents(t, want[1:], got)
+	})
+
+	t.Run("list most recent revision", func(t *testing.T) {
+		s := newStorage(t)
+		require.NoError(t, s.CreateEvents(ctx, []feed.Event{
+			newEvent(1, 1, "a1", baseT),
+			newEvent(2, 1, "b1", baseT),
+		}))
+		require.NoError(t, s.CreateEvents(ctx, []feed.Event{
+			newEvent(1, 2, "a2", baseT.Add(time.Minute)),
+		}))
+		require.NoError(t, s.CreateEvents(ctx, []feed.Event{
+			newEvent(1, 3, "a3", baseT.Add(2*time.Minute)),
+		}))
+
+		got, err := s.ListUniqueEvents(ctx, []uuid.UUID{newID(1), newID(2)})
+		require.NoError(t, err)
+		requireEvents(t, []feed.Event{
+			newEvent(1, 3, "a3", baseT.Add(2*time.Minute)),
+			newEvent(2, 1, "b1", baseT),
+		}, got)
+	})
+
+	t.Run("existing revision is rejected", func(t *testing.T) {
+		s := newStorage(t)
+		require.NoError(t, s.CreateEvents(ctx, []feed.Event{
+			newEvent(1, 1, "a1", baseT),
+		}))
+		err := s.CreateEvents(ctx, []feed.Event{
+			newEvent(2, 1, "b1", baseT),
+			newEvent(1, 1, "a1-again", baseT),
+		})
+		require.Error(t, err)
+
+		// The batch is rejected as a whole
+		got, err := s.ListUniqueEvents(ctx, []uuid.UUID{newID(1), newID(2)})
+		require.NoError(t, err)
+		requireEvents(t, []feed.Event{newEvent(1, 1, "a1", baseT)}, got)
+	})
+
+	t.Run("update revisions", func(t *testing.T) {
+		s := newStorage(t)
+		rssEvents := []feed.Event{
+			newEvent(1, 0, "a1", baseT),
+			newEvent(2, 0, "b1", baseT),
+		}
+		source := feed.NewRSSAdapter([]string{},
+			func(ctx context.Context, regionIDs []string) ([]feed.Event, error) {
+				return append([]feed.Event(nil), rssEvents...), nil
+			},
+		)
+		up := feed.NewUpdater()
+		res, err := up.Update(ctx, source, s)
+		require.NoError(t, err)
+		require.Equal(t, feed.UpdateResult{Created: 2}, res)
+
+		rssEvents[1] = newEvent(2, 0, "b2", baseT.Add(time.Minute))
+		res, err = up.Update(ctx, source, s)
+		require.NoError(t, err)
+		require.Equal(t, feed.UpdateResult{Revised: 1, Unchanged: 1}, res)
+		res, err = up.Update(ctx, source, s)
+		require.NoError(t, err)
+		require.Equal(t, feed.UpdateResult{Unchanged: 2}, res)
+
+		got, err := s.ListUniqueEvents(ctx, []uuid.UUID{newID(1), newID(2)})
+		require.NoError(t, err)
+		requireEvents(t, []feed.Event{
+			newEvent(1, 1, "a1", baseT),
+			newEvent(2, 2, "b2", baseT.Add(time.Minute)),
+		}, got)
+	})
+
+	t.Run("update removed events", func(t *testing.T) {
+		s := newStorage(t)
+		rssEvents := []feed.Event{
+			newEvent(1, 0, "a1", baseT),
+			newEvent(2, 0, "b1", baseT.Add(time.Minute)),
+			newEvent(3, 0, "c1", baseT.Add(2*time.Minute)),
+		}
+		source := feed.NewRSSAdapter([]string{},
+			func(ctx context.Context, regionIDs []string) ([]feed.Event, error) {
+				return append([]feed.Event(nil), rssEvents...), nil
+			},
+		)
+		up := feed.NewUpdater()
+		res, err := up.Update(ctx, source, s)
+		require.NoError(t, err)
+		require.Equal(t, feed.UpdateResult{Created: 3}, res)
+
+		// The event must be missing from consecutive fetches
+		removed := rssEvents[1]
+		rssEvents = []feed.Event{rssEvents[0], rssEvents[2]}
+		res, err = up.Update(ctx, source, s)
+		require.NoError(t, err)
+		require.Equal(t, feed.UpdateResult{Unchanged: 2}, res)
+		res, err = up.Update(ctx, source, s)
+		require.NoError(t, err)
+		require.Equal(t, feed.UpdateResult{Unchanged: 2, Removed: 1}, res)
+		res, err = up.Update(ctx, source, s)
+		require.NoError(t, err)
+		require.Equal(t, feed.UpdateResult{Unchanged: 2}, res)
+
+		got, err := s.ListUniqueEvents(ctx, []uuid.UUID{newID(2)})
+		require.NoError(t, err)
+		requireEvents(t, []feed.Event{newEvent(2, 2, "b1", baseT.Add(time.Minute))}, got)
+		require.True(t, got[0].Removed)
+
+		// A reappearing event gets a new revision
+		rssEvents = append(rssEvents, removed)
+		res, err = up.Update(ctx, source, s)
+		require.NoError(t, err)
+		require.Equal(t, feed.UpdateResult{Revised: 1, Unchanged: 2}, res)
+		got, err = s.ListUniqueEvents(ctx, []uuid.UUID{newID(2)})
+		require.NoError(t, err)
+		requireEvents(t, []feed.Event{newEvent(2, 3, "b1", baseT.Add(time.Minute))}, got)
+		require.False(t, got[0].Removed)
+	})
+
+	t.Run("mark events seen", func(t *testing.T) {
+		s := newStorage(t)
+		marker, ok := s.(feed.EventSeenMarker)
+		if !ok {
+			t.Skip("storage does not implement feed.EventSeenMarker")
+		}
+		require.NoError(t, s.CreateEvents(ctx, []feed.Event{
+			newEvent(1, 1, "a1", baseT),
+			newEvent(2, 1, "b1", baseT),
+		}))
+		ids := []uuid.UUID{newID(1), newID(2)}
+		require.NoError(t, marker.MarkEventsSeen(ctx, ids, baseT))
+		require.NoError(t, marker.MarkEventsSeen(ctx, ids[:1], baseT.Add(2*time.Minute)))
+		// Marking an event seen at an earlier time keeps the last seen time
+		require.NoError(t, marker.MarkEventsSeen(ctx, ids[:1], baseT.Add(time.Minute)))
+
+		got, err := s.ListUniqueEvents(ctx, ids)
+		require.NoError(t, err)
+		requireEvents(t, []feed.Event{
+			newEvent(1, 1, "a1", baseT),
+			newEvent(2, 1, "b1", baseT),
+		}, got)
+		requireTime(t, baseT, got[0].FirstSeenTime)
+		requireTime(t, baseT.Add(2*time.Minute), got[0].LastSeenTime)
+		requireTime(t, baseT, got[1].FirstSeenTime)
+		requireTime(t, baseT, got[1].LastSeenTime)
+	})
+
+	t.Run("list latest events", func(t *testing.T) {
+		s := newStorage(t)
+		lister, ok := s.(feed.LatestEventLister)
+		if !ok {
+			t.Skip("storage does not implement feed.LatestEventLister")
+		}
+		require.NoError(t, s.CreateEvents(ctx, []feed.Event{
+			newEvent(1, 1, "a1", baseT),
+			newEvent(2, 1, "b1", baseT.Add(time.Minute)),
+			newEvent(3, 1, "c1", baseT.Add(2*time.Minute)),
+			newEvent(1, 2, "a2", baseT.Add(3*time.Minute)),
+		}))
+		got, err := lister.ListLatestEvents(ctx, 2)
+		require.NoError(t, err)
+		require.Len(t, got, 2)
+		requireEvent(t, newEvent(1, 2, "a2", baseT.Add(3*time.Minute)), got[0])
+		requireEvent(t, newEvent(3, 1, "c1", baseT.Add(2*time.Minute)), got[1])
+	})
+
+	t.Run("list event changes", func(t *testing.T) {
+		s := newStorage(t)
+		lister, ok := s.(feed.ChangeLister)
+		if !ok {
+			t.Skip("storage does not implement feed.ChangeLister")
+		}
+		events := []feed.Event{
+			newEvent(2, 1, "b1", baseT),
+			newEvent(1, 1, "a1", baseT),
+			newEvent(1, 2, "a2", baseT.Add(time.Minute)),
+			newEvent(3, 1, "c1", baseT.Add(-time.Minute)),
+		}
+		require.NoError(t, s.CreateEvents(ctx, events[:2]))
+		require.NoError(t, s.CreateEvents(ctx, events[2:3]))
+		require.NoError(t, s.CreateEvents(ctx, events[3:]))
+
+		got, err := lister.ListEventChanges(ctx, feed.ChangeCursor{}, 3)
+		require.NoError(t, err)
+		require.Len(t, got, 3)
+		// The order within a batch is up to the storage.
+		requireEvents(t, []feed.Event{events[0], events[1]}, []feed.Event{got[0].Event, got[1].Event})
+		requireEvent(t, events[2], got[2].Event)
+
+		// c1 is created last, regardless of its create time.
+		got, err = lister.ListEventChanges(ctx, got[2].Cursor, 3)
+		require.NoError(t, err)
+		require.Len(t, got, 1)
+		requireEvent(t, events[3], got[0].Event)
+
+		cursor, err := feed.ParseChangeCursor(got[0].Cursor.String())
+		require.NoError(t, err)
+		got, err = lister.ListEventChanges(ctx, cursor, 3)
+		require.NoError(t, err)
+		require.Empty(t, got)
+
+		got, err = lister.ListEventChanges(ctx, feed.StartCursor(baseT), 3)
+		require.NoError(t, err)
+		require.Len(t, got, 1)
+		requireEvent(t, events[2], got[0].Event)
+	})
+}
+
+func newID(n byte) uuid.UUID {
+	var id uuid.UUID
+	id[0] = n
+	return id
+}
+
+func newEvent(n byte, revision int32, title string, publishTime time.Time) feed.Event {
+	return feed.Event{
+		ID:          newID(n),
+		URL:         "https://polisen.se/aktuellt/handelser/" + title,
+		Title:       title,
+		Region:      "Händelser RSS - Blekinge",
+		Description: "Beskrivning av " + title,
+		Revision:    revision,
+		CreateTime:  publishTime,
+		PublishTime: publishTime,
+		ContentHash: []byte(title),
+	}
+}
+
+func requireEvents(t *testing.T, want, got []feed.Event) {
+	t.Helper()
+	require.Len(t, got, len(want))
+	sort.Slice(got, func(i, j int) bool {
+		return got[i].ID[0] < got[j].ID[0]
+	})
+	sort.Slice(want, func(i, j int) bool {
+		return want[i].ID[0] < want[j].ID[0]
+	})
+	for i := range want {
+		requireEvent(t, want[i], got[i])
+	}
+}
+
+func requireTime(t *testing.T, want, got time.Time) {
+	t.Helper()
+	require.True(t, want.Equal(got), "want %v, got %v", want, got)
+}
+
+func requireEvent(t *testing.T, want, got feed.Event) {
+	t.Helper()
+	require.Equal(t, want.ID, got.ID)
+	require.Equal(t, want.Revision, got.Revision)
+	require.Equal(t, want.URL, got.URL)
+	require.Equal(t, want.Title, got.Title)
+	require.Equal(t, want.Region, got.Region)
+	require.Equal(t, want.Description, got.Description)
+	require.Equal(t, want.ArticleContents, got.ArticleContents)
+	require.Equal(t, want.ContentHash, got.ContentHash)
+	require.True(t, want.PublishTime.Equal(got.PublishTime),
+		"publish time: want %v, got %v", want.PublishTime, got.PublishTime)
+}
@@ -0,0 +1,77 @@
+package feedtest
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/sebnyberg/autodotenv"
+	"github.com/sebnyberg/policefeed/feed"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDatabaseEnv is the environment variable which names the Postgres
+// database used by tests. Tests remove all data in it, so it must be a
+// throwaway database, never one with data worth keeping.
+const TestDatabaseEnv = "POLICEFEED_TEST_DATABASE"
+
+// OpenPostgres opens the test database named by TestDatabaseEnv on the server
+// given by the standard PG environment variables, and migrates its schema.
+// The test is skipped unless the database is given and available.
+func OpenPostgres(t *testing.T) *sql.DB {
+	t.Helper()
+	if _, err := autodotenv.LoadDotenvIfExists(); err != nil {
+		t.Fatal(err)
+	}
+	database := os.Getenv(TestDatabaseEnv)
+	if database == "" {
+		t.Skipf("%v is not set", TestDatabaseEnv)
+	}
+	conf := feed.DBConfig{
+		DBConnMaxLifetime: "300s",
+		DBMaxIdleConns:    2,
+		DBMaxOpenConns:    2,
+		PGDatabase:        database,
+		PGHost:            os.Getenv("PGHOST"),
+		PGPassword:        os.Getenv("PGPASSWORD"),
+		PGPort:            5432,
+		PGSSLMode:         os.Getenv("PGSSLMODE"),
+		PGUser:            os.Getenv("PGUSER"),
+	}
+	if port := os.Getenv("PGPORT"); port != "" {
+		_, err := fmt.Sscan(port, &conf.PGPort)
+		require.NoError(t, err)
+	}
+	db, err := conf.OpenDB()
+	if err != nil {
+		t.Skipf("postgres is not available, %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	require.NoError(t, feed.ValidateSchema(db))
+	return db
+}
+
+// TruncatePostgres removes all rows from the tables of the test database,
+// except for the schema version.
+func TruncatePostgres(t *testing.T, db *sql.DB) {
+	t.Helper()
+	rows, err := db.Query(`
+select tablename
+from pg_tables
+where schemaname = current_schema()
+  and tablename <> 'schema_migrations'`)
+	require.NoError(t, err)
+	defer rows.Close()
+	var tables []string
+	for rows.Next() {
+		var name string
+		require.NoError(t, rows.Scan(&name))
+		tables = append(tables, pgx.Identifier{name}.Sanitize())
+	}
+	require.NoError(t, rows.Err())
+	_, err = db.Exec("truncate " + strings.Join(tables, ", "))
+	require.NoError(t, err)
+}
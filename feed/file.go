@@ -0,0 +1,337 @@
+package feed
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var _ EventListerCreator = new(FileStorage)
+
+var _ LatestEventLister = new(FileStorage)
+
+const (
+	eventFilePrefix = "events-"
+	eventFileSuffix = ".jsonl.gz"
+)
+
+// FileStorage appends event revisions to gzip-compressed JSONL files in a
+// directory, one file per day of creation (UTC). Each call to CreateEvents
+// appends a new gzip member to the file of the day, which keeps the files
+// readable by standard tools such as zcat.
+//
+// The most recent revision of each event is kept in memory, and rebuilt from
+// the files when the storage is opened.
+type FileStorage struct {
+	dir string
+
+	// latest contains the most recent revision of each event.
+	latest map[uuid.UUID]Event
+	// revisions contains all revision numbers of each event.
+	revisions map[uuid.UUID][]int32
+	mtx       sync.RWMutex
+}
+
+// fileEvent is the JSON representation of an Event in a file.
+type fileEvent struct {
+	ID              uuid.UUID `json:"id"`
+	URL             string    `json:"url"`
+	Title           string    `json:"title"`
+	Region          string    `json:"region"`
+	Description     string    `json:"description"`
+	ArticleContents string    `json:"articleContents,omitempty"`
+	Revision        int32     `json:"revision"`
+	CreateTime      time.Time `json:"createTime"`
+	PublishTime     time.Time `json:"publishTime"`
+	ContentHash     []byte    `json:"contentHash"`
+	Removed         bool      `json:"removed,omitempty"`
+}
+
+func newFileEvent(evt Event) fileEvent {
+	return fileEvent{
+		ID:              evt.ID,
+		URL:             evt.URL,
+		Title:           evt.Title,
+		Region:          evt.Region,
+		Description:     evt.Description,
+		ArticleContents: evt.ArticleContents,
+		Revision:        evt.Revision,
+		CreateTime:      evt.CreateTime,
+		PublishTime:     evt.PublishTime,
+		ContentHash:     evt.ContentHash,
+		Removed:         evt.Removed,
+	}
+}
+
+func (fe fileEvent) event() Event {
+	return Event{
+		ID:              fe.ID,
+		URL:             fe.URL,
+		Title:           fe.Title,
+		Region:          fe.Region,
+		Description:     fe.Description,
+		ArticleContents: fe.ArticleContents,
+		Revision:        fe.Revision,
+		CreateTime:      fe.CreateTime,
+		PublishTime:     fe.PublishTime,
+		ContentHash:     fe.ContentHash,
+		Removed:         fe.Removed,
+	}
+}
+
+// OpenFileStorage opens the event files in dir, creating the directory if it
+// does not exist. Files with a truncated tail, e.g. after a crash during a
+// write, are rewritten to contain only their readable events.
+func OpenFileStorage(dir string) (*FileStorage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create event dir err, %w", err)
+	}
+	s := &FileStorage{
+		dir:       dir,
+		latest:    make(map[uuid.UUID]Event),
+		revisions: make(map[uuid.UUID][]int32),
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, eventFilePrefix+"*"+eventFileSuffix))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		events, err := readEventFile(path)
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			slog.Warn("Repairing truncated event file", "path", path)
+			err = rewriteEventFile(path, events)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read event file %v err, %w", path, err)
+		}
+		for _, evt := range events {
+			s.add(evt)
+		}
+	}
+	return s, nil
+}
+
+// readEventFile reads all events in the file. If the file is truncated, the
+// events that could be read are returned together with io.ErrUnexpectedEOF.
+func readEventFile(path string) ([]Event, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		if err == io.EOF { // empty file
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer zr.Close()
+
+	var events []Event
+	sc := bufio.NewScanner(zr)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		var fe fileEvent
+		if err := json.Unmarshal(sc.Bytes(), &fe); err != nil {
+			// A partially written last line
+			return events, io.ErrUnexpectedEOF
+		}
+		events = append(events, fe.event())
+	}
+	if err := sc.Err(); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, gzip.ErrChecksum) {
+			return events, io.ErrUnexpectedEOF
+		}
+		return events, err
+	}
+	return events, nil
+}
+
+func rewriteEventFile(path string, events []Event) error {
+	tmpPath := path + ".tmp"
+	if err := writeEventFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, events); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// writeEventFile writes the events as a single gzip member to the file.
+func writeEventFile(path string, flag int, events []Event) (retErr error) {
+	f, err := os.OpenFile(path, flag, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := f.Close(); retErr == nil {
+			retErr = err
+		}
+	}()
+	zw := gzip.NewWriter(f)
+	enc := json.NewEncoder(zw)
+	for _, evt := range events {
+		if err := enc.Encode(newFileEvent(evt)); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+func (s *FileStorage) add(evt Event) {
+	s.revisions[evt.ID] = append(s.revisions[evt.ID], evt.Revision)
+	if cur, exists := s.latest[evt.ID]; !exists || cur.Revision < evt.Revision {
+		s.latest[evt.ID] = evt
+	}
+}
+
+// ListUniqueEvents lists the most recent revision of each event. If ids is
+// non-empty, it is used to filter the result.
+func (s *FileStorage) ListUniqueEvents(
+	ctx context.Context,
+	ids []uuid.UUID,
+) ([]Event, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	if len(ids) == 0 {
+		ids = keys(s.latest)
+	}
+	events := make([]Event, 0, len(ids))
+	for _, id := range ids {
+		if evt, exists := s.latest[id]; exists {
+			events = append(events, evt)
+		}
+	}
+	return events, nil
+}
+
+func (s *FileStorage) ListLatestEvents(
+	ctx context.Context,
+	limit int,
+) ([]Event, error) {
+	events, err := s.ListUniqueEvents(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].PublishTime.After(events[j].PublishTime)
+	})
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	return events, nil
+}
+
+// CreateEvents appends the provided event revisions to the file of the day of
+// their creation time. If any revision already exists, or a write fails, no
+// events are written: the files written so far are truncated to their
+// previous size. Each file is written in one append, so a crash during a write
+// leaves at most the last gzip member of a file truncated, which is repaired
+// on open, but may leave the events of other days written.
+func (s *FileStorage) CreateEvents(ctx context.Context, events []Event) (retErr error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	// Validate that no revision already exists
+	type key struct {
+		id       uuid.UUID
+		revision int32
+	}
+	seen := make(map[key]struct{}, len(events))
+	for _, evt := range events {
+		k := key{evt.ID, evt.Revision}
+		if _, exists := seen[k]; exists {
+			return fmt.Errorf("duplicate revision %v of event %v", evt.Revision, evt.ID)
+		}
+		seen[k] = struct{}{}
+		for _, rev := range s.revisions[evt.ID] {
+			if rev == evt.Revision {
+				return fmt.Errorf("revision %v of event %v already exists", evt.Revision, evt.ID)
+			}
+		}
+	}
+
+	// Group by day
+	byPath := make(map[string][]Event)
+	for _, evt := range events {
+		path := s.path(evt.CreateTime)
+		byPath[path] = append(byPath[path], evt)
+	}
+	paths := keys(byPath)
+	sort.Strings(paths)
+
+	// Undo the appends if any write fails
+	sizes := make(map[string]int64, len(paths))
+	defer func() {
+		if retErr == nil {
+			return
+		}
+		for path, size := range sizes {
+			if err := truncateEventFile(path, size); err != nil {
+				retErr = fmt.Errorf("%w, truncate event file err, %v", retErr, err)
+			}
+		}
+	}()
+	for _, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		fi, err := os.Stat(path)
+		switch {
+		case err == nil:
+			sizes[path] = fi.Size()
+		case errors.Is(err, os.ErrNotExist):
+			sizes[path] = 0
+		default:
+			return fmt.Errorf("stat event file err, %w", err)
+		}
+		err = writeEventFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, byPath[path])
+		if err != nil {
+			return fmt.Errorf("write event file err, %w", err)
+		}
+	}
+	for _, evt := range events {
+		s.add(evt)
+	}
+	return nil
+}
+
+// truncateEventFile truncates the file to size, removing it if it is emptied.
+func truncateEventFile(path string, size int64) error {
+	if size == 0 {
+		err := os.Remove(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := f.Truncate(size); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+func (s *FileStorage) path(createTime time.Time) string {
+	day := createTime.UTC().Format("2006-01-02")
+	return filepath.Join(s.dir, eventFilePrefix+day+eventFileSuffix)
+}
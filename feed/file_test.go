@@ -0,0 +1,142 @@
+package feed
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStorageReopen(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	day1 := time.Date(2022, 2, 8, 23, 0, 0, 0, time.UTC)
+	day2 := day1.Add(2 * time.Hour)
+	newEvent := func(url string, revision int32, createTime time.Time) Event {
+		return Event{
+			ID:          NewEventID(url),
+			URL:         url,
+			Title:       url,
+			Revision:    revision,
+			CreateTime:  createTime,
+			PublishTime: createTime,
+			ContentHash: []byte(url),
+		}
+	}
+
+	s, err := OpenFileStorage(dir)
+	require.NoError(t, err)
+	require.NoError(t, s.CreateEvents(ctx, []Event{
+		newEvent("a", 1, day1),
+		newEvent("b", 1, day1),
+	}))
+	require.NoError(t, s.CreateEvents(ctx, []Event{
+		newEvent("a", 2, day2),
+	}))
+	paths, err := filepath.Glob(filepath.Join(dir, "*"))
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		filepath.Join(dir, "events-2022-02-08.jsonl.gz"),
+		filepath.Join(dir, "events-2022-02-09.jsonl.gz"),
+	}, paths)
+
+	// Truncate the last gzip member of the second day halfway
+	path := filepath.Join(dir, "events-2022-02-09.jsonl.gz")
+	before, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, s.CreateEvents(ctx, []Event{
+		newEvent("b", 2, day2),
+	}))
+	after, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(path, (before.Size()+after.Size())/2))
+
+	// Reopen and verify that the index is rebuilt from readable events
+	s, err = OpenFileStorage(dir)
+	require.NoError(t, err)
+	got, err := s.ListUniqueEvents(ctx, []uuid.UUID{NewEventID("a"), NewEventID("b")})
+	require.NoError(t, err)
+	revisions := make(map[string]int32)
+	for _, evt := range got {
+		revisions[evt.URL] = evt.Revision
+	}
+	require.Equal(t, map[string]int32{"a": 2, "b": 1}, revisions)
+
+	// The repaired file can be appended to
+	require.NoError(t, s.CreateEvents(ctx, []Event{
+		newEvent("b", 2, day2),
+	}))
+	s, err = OpenFileStorage(dir)
+	require.NoError(t, err)
+	got, err = s.ListUniqueEvents(ctx, []uuid.UUID{NewEventID("b")})
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	require.Equal(t, int32(2), got[0].Revision)
+}
+
+// failAfterContext fails Err after it has been called n times.
+type failAfterContext struct {
+	context.Context
+	n int
+}
+
+func (c *failAfterContext) Err() error {
+	if c.n == 0 {
+		return context.Canceled
+	}
+	c.n--
+	return nil
+}
+
+func TestFileStorageFailedWrite(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	day1 := time.Date(2022, 2, 8, 23, 0, 0, 0, time.UTC)
+	day2 := day1.Add(2 * time.Hour)
+	newEvent := func(url string, createTime time.Time) Event {
+		return Event{
+			ID:          NewEventID(url),
+			URL:         url,
+			Revision:    1,
+			CreateTime:  createTime,
+			PublishTime: createTime,
+			ContentHash: []byte(url),
+		}
+	}
+	s, err := OpenFileStorage(dir)
+	require.NoError(t, err)
+	require.NoError(t, s.CreateEvents(ctx, []Event{newEvent("a", day1)}))
+	path := filepath.Join(dir, "events-2022-02-08.jsonl.gz")
+	before, err := os.Stat(path)
+	require.NoError(t, err)
+
+	// The batch fails after the file of the first day has been written
+	err = s.CreateEvents(&failAfterContext{Context: ctx, n: 1}, []Event{
+		newEvent("b", day1),
+		newEvent("c", day2),
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	after, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, before.Size(), after.Size())
+	_, err = os.Stat(filepath.Join(dir, "events-2022-02-09.jsonl.gz"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+	got, err := s.ListUniqueEvents(ctx, nil)
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+
+	// The batch can be retried
+	require.NoError(t, s.CreateEvents(ctx, []Event{
+		newEvent("b", day1),
+		newEvent("c", day2),
+	}))
+	s, err = OpenFileStorage(dir)
+	require.NoError(t, err)
+	got, err = s.ListUniqueEvents(ctx, nil)
+	require.NoError(t, err)
+	require.Len(t, got, 3)
+}
@@ -0,0 +1,149 @@
+package feed
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// LeaderElection elects a single leader among processes sharing a Postgres
+// database, using a session-level advisory lock.
+//
+// The lock is held by a dedicated connection. If the session of the leader
+// dies, e.g. because the process crashed or the network failed, Postgres
+// releases the lock and another process takes over.
+type LeaderElection struct {
+	db  *sql.DB
+	key int64
+	// retryInterval is the time between attempts to acquire the lock.
+	retryInterval time.Duration
+	// checkInterval is the time between checks that the session of the
+	// leader is still alive.
+	checkInterval time.Duration
+}
+
+// NewLeaderElection returns a leader election for the advisory lock key.
+// Processes which use the same key compete for the same leadership.
+func NewLeaderElection(db *sql.DB, key int64) *LeaderElection {
+	return &LeaderElection{
+		db:            db,
+		key:           key,
+		retryInterval: 5 * time.Second,
+		checkInterval: 5 * time.Second,
+	}
+}
+
+// ErrLeadershipLost is the cause of the context passed to the function of
+// RunAsLeader when the session holding the lock is lost.
+var ErrLeadershipLost = errors.New("leadership lost")
+
+// RunAsLeader waits until this process is the leader and then runs fn. The
+// context passed to fn is cancelled if leadership is lost, in which case
+// RunAsLeader waits to become the leader again and reruns fn.
+//
+// RunAsLeader returns when ctx is cancelled or fn returns an error while
+// still being the leader.
+func (l *LeaderElection) RunAsLeader(ctx context.Context, fn func(ctx context.Context) error) error {
+	for {
+		conn, err := l.acquire(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			Logger(ctx).Warn("Acquire leadership failed", "error", err)
+		}
+		if conn == nil {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(l.retryInterval):
+			}
+			continue
+		}
+
+		Logger(ctx).Info("Acquired leadership", "lock_key", l.key)
+		isLeader.Set(1)
+		err = l.lead(ctx, conn, fn)
+		isLeader.Set(0)
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		Logger(ctx).Warn("Lost leadership", "lock_key", l.key)
+	}
+}
+
+// acquire tries to take the lock. It returns the connection which holds the
+// lock, or nil if another process holds it.
+func (l *LeaderElection) acquire(ctx context.Context) (*sql.Conn, error) {
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("open conn err, %w", err)
+	}
+	var locked bool
+	err = conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", l.key).Scan(&locked)
+	if err != nil || !locked {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// lead runs fn until it returns or the session holding the lock is lost.
+func (l *LeaderElection) lead(
+	ctx context.Context, conn *sql.Conn, fn func(ctx context.Context) error,
+) error {
+	leaderCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	// Watch the session which holds the lock
+	watchDone := make(chan struct{})
+	go func() {
+		defer close(watchDone)
+		for {
+			select {
+			case <-leaderCtx.Done():
+				return
+			case <-time.After(l.checkInterval):
+			}
+			if err := conn.PingContext(leaderCtx); err != nil && leaderCtx.Err() == nil {
+				Logger(ctx).Error("Leader session check failed", "error", err)
+				cancel(ErrLeadershipLost)
+				return
+			}
+		}
+	}()
+
+	err := fn(leaderCtx)
+	lost := errors.Is(context.Cause(leaderCtx), ErrLeadershipLost)
+	cancel(nil)
+	<-watchDone
+
+	if lost {
+		// Discard the connection, in case the session is still alive and
+		// holds the lock
+		conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		conn.Close()
+		return nil
+	}
+
+	// Release the lock before the connection is returned to the pool
+	unlockCtx, unlockCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer unlockCancel()
+	if _, unlockErr := conn.ExecContext(unlockCtx,
+		"SELECT pg_advisory_unlock($1)", l.key); unlockErr != nil {
+		Logger(ctx).Error("Release leadership failed", "error", unlockErr)
+		// Make sure the session, and with it the lock, does not outlive us
+		conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	}
+	conn.Close()
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
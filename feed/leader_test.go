@@ -0,0 +1,79 @@
+package feed_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sebnyberg/policefeed/feed"
+	"github.com/sebnyberg/policefeed/feed/feedtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLeaderElection(t *testing.T) {
+	db := feedtest.OpenPostgres(t)
+	db.SetMaxOpenConns(5)
+	const key = 42
+
+	type leader struct {
+		ctx  context.Context
+		name string
+	}
+	leaders := make(chan leader)
+	run := func(ctx context.Context, name string) <-chan error {
+		e := feed.NewLeaderElection(db, key)
+		feed.SetLeaderElectionIntervals(e, 10*time.Millisecond, 10*time.Millisecond)
+		done := make(chan error, 1)
+		go func() {
+			done <- e.RunAsLeader(ctx, func(ctx context.Context) error {
+				leaders <- leader{ctx: ctx, name: name}
+				<-ctx.Done()
+				return nil
+			})
+		}()
+		return done
+	}
+	next := func() leader {
+		t.Helper()
+		select {
+		case l := <-leaders:
+			return l
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a leader")
+			return leader{}
+		}
+	}
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	defer cancel1()
+	done1 := run(ctx1, "a")
+	require.Equal(t, "a", next().name)
+
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+	done2 := run(ctx2, "b")
+	select {
+	case l := <-leaders:
+		t.Fatalf("%v became leader while a was the leader", l.name)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Stepping down hands over leadership
+	cancel1()
+	require.NoError(t, <-done1)
+	b := next()
+	require.Equal(t, "b", b.name)
+
+	// Failover when the session of the leader dies
+	_, err := db.Exec(`
+		SELECT pg_terminate_backend(pid) FROM pg_locks
+		WHERE locktype = 'advisory' AND objid = $1 AND granted`, key)
+	require.NoError(t, err)
+	<-b.ctx.Done()
+	require.True(t, errors.Is(context.Cause(b.ctx), feed.ErrLeadershipLost))
+	require.Equal(t, "b", next().name)
+
+	cancel2()
+	require.NoError(t, <-done2)
+}
@@ -0,0 +1,336 @@
+package feed
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/sebnyberg/policefeed/feed/feedpg"
+)
+
+// RegionLeases splits regions between replicas sharing a Postgres database,
+// so that each region is updated by a single replica.
+//
+// Replicas register themselves with heartbeats. Regions are assigned to the
+// live replicas in turn, ordered by replica ID, and each replica claims a
+// lease for its regions. A lease is only taken over when it has been released
+// by its previous owner, or when it has expired because the owner stopped
+// sending heartbeats. When replicas join or leave, the regions are rebalanced
+// on the following heartbeats.
+type RegionLeases struct {
+	queries   *feedpg.Queries
+	replicaID string
+	regionIDs []string
+	// heartbeatInterval is the time between heartbeats, which also renew the
+	// leases.
+	heartbeatInterval time.Duration
+	// ttl is the time after the last heartbeat when a replica is considered
+	// dead and its leases expire.
+	ttl time.Duration
+
+	// useMtx is held for reading while regions are used, so that leases are
+	// not released in the middle of an update.
+	useMtx sync.RWMutex
+	mtx    sync.Mutex
+	owned  map[string]bool
+	// validUntil is the time when the owned leases expire unless renewed.
+	validUntil time.Time
+	onChange   func()
+}
+
+// NewRegionLeases returns region leases for the replica, which shares the
+// regions with other replicas.
+func NewRegionLeases(db *sql.DB, replicaID string, regionIDs []string) *RegionLeases {
+	return &RegionLeases{
+		queries:           feedpg.New(db),
+		replicaID:         replicaID,
+		regionIDs:         regionIDs,
+		heartbeatInterval: 10 * time.Second,
+		ttl:               30 * time.Second,
+		owned:             make(map[string]bool),
+	}
+}
+
+// OnChange registers a function which is called when the owned regions
+// change, e.g. to update newly owned regions right away. It must not block.
+func (l *RegionLeases) OnChange(fn func()) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.onChange = fn
+}
+
+// Run sends heartbeats and claims leases until the context is cancelled,
+// after which the leases of the replica are released.
+func (l *RegionLeases) Run(ctx context.Context) error {
+	defer l.release()
+	for {
+		if err := l.heartbeat(ctx); err != nil && ctx.Err() == nil {
+			Logger(ctx).Error("Region lease heartbeat failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(l.heartbeatInterval):
+		}
+	}
+}
+
+// Use calls fn with the regions among regionIDs which are owned by the
+// replica. Leases are not released while fn runs.
+func (l *RegionLeases) Use(regionIDs []string, fn func(owned []string) error) error {
+	l.useMtx.RLock()
+	defer l.useMtx.RUnlock()
+	l.mtx.Lock()
+	var owned []string
+	if time.Now().Before(l.validUntil) {
+		for _, id := range regionIDs {
+			if l.owned[id] {
+				owned = append(owned, id)
+			}
+		}
+	}
+	l.mtx.Unlock()
+	return fn(owned)
+}
+
+// ErrLeaseLost is returned by RegionLeases.Check when the replica no longer
+// holds the lease of a region.
+var ErrLeaseLost = errors.New("region lease lost")
+
+// Check returns ErrLeaseLost unless the replica holds unexpired leases of all
+// the regions in the database.
+func (l *RegionLeases) Check(ctx context.Context, regionIDs []string) error {
+	l.mtx.Lock()
+	valid := time.Now().Before(l.validUntil)
+	l.mtx.Unlock()
+	if !valid {
+		return fmt.Errorf("%w: leases of %v expired", ErrLeaseLost, l.replicaID)
+	}
+	n, err := l.queries.CountRegionLeases(ctx, feedpg.CountRegionLeasesParams{
+		Owner:     l.replicaID,
+		RegionIds: regionIDs,
+	})
+	if err != nil {
+		return fmt.Errorf("check leases err, %w", err)
+	}
+	if int(n) != len(regionIDs) {
+		return fmt.Errorf("%w: %v holds %v of %v leases",
+			ErrLeaseLost, l.replicaID, n, len(regionIDs))
+	}
+	return nil
+}
+
+// Fence returns a target which creates events in target only while the
+// replica holds the leases of the regions. This keeps a replica whose leases
+// expired during an update, e.g. because its heartbeats failed, from writing
+// events of regions which another replica has taken over.
+//
+// EventStorage checks the leases in the transaction which creates the events,
+// and locks them so that they cannot be taken over before it commits. Other
+// storage is only fenced by the lease expiry known to the replica.
+func (l *RegionLeases) Fence(target EventListerCreator, regionIDs []string) EventListerCreator {
+	return &fencedTarget{
+		EventListerCreator: target,
+		leases:             l,
+		regionIDs:          regionIDs,
+	}
+}
+
+var _ EventSeenMarker = new(fencedTarget)
+
+// fencedTarget creates events only while the leases of its regions are held.
+type fencedTarget struct {
+	EventListerCreator
+	leases    *RegionLeases
+	regionIDs []string
+}
+
+func (t *fencedTarget) CreateEvents(ctx context.Context, events []Event) error {
+	if len(events) == 0 {
+		return t.EventListerCreator.CreateEvents(ctx, events)
+	}
+	t.leases.mtx.Lock()
+	valid := time.Now().Before(t.leases.validUntil)
+	t.leases.mtx.Unlock()
+	if !valid {
+		return fmt.Errorf("%w: leases of %v expired", ErrLeaseLost, t.leases.replicaID)
+	}
+	ctx = context.WithValue(ctx, leaseFenceKey{}, leaseFence{
+		owner:     t.leases.replicaID,
+		regionIDs: t.regionIDs,
+	})
+	return t.EventListerCreator.CreateEvents(ctx, events)
+}
+
+// leaseFence contains the leases which must be held by the transaction which
+// creates events, see RegionLeases.Fence.
+type leaseFence struct {
+	owner     string
+	regionIDs []string
+}
+
+type leaseFenceKey struct{}
+
+// lockRegionLeases locks the unexpired leases of the owner, so that they are
+// not claimed by other replicas until the transaction ends.
+const lockRegionLeases = `
+select region_id
+from region_lease
+where owner = $1
+  and region_id = any ($2::text[])
+  and expire_time > now()
+for share`
+
+// checkLeaseFence returns ErrLeaseLost unless tx holds the leases of the fence
+// in ctx, if any.
+func checkLeaseFence(ctx context.Context, tx pgx.Tx) error {
+	fence, ok := ctx.Value(leaseFenceKey{}).(leaseFence)
+	if !ok {
+		return nil
+	}
+	rows, err := tx.Query(ctx, lockRegionLeases, fence.owner, fence.regionIDs)
+	if err != nil {
+		return fmt.Errorf("lock leases err, %w", err)
+	}
+	var n int
+	for rows.Next() {
+		n++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("lock leases err, %w", err)
+	}
+	if n != len(fence.regionIDs) {
+		return fmt.Errorf("%w: %v holds %v of %v leases",
+			ErrLeaseLost, fence.owner, n, len(fence.regionIDs))
+	}
+	return nil
+}
+
+func (t *fencedTarget) MarkEventsSeen(
+	ctx context.Context, ids []uuid.UUID, seenTime time.Time,
+) error {
+	marker, ok := t.EventListerCreator.(EventSeenMarker)
+	if !ok {
+		return nil
+	}
+	return marker.MarkEventsSeen(ctx, ids, seenTime)
+}
+
+func (l *RegionLeases) heartbeat(ctx context.Context) error {
+	start := time.Now()
+	if err := l.queries.HeartbeatReplica(ctx, l.replicaID); err != nil {
+		return fmt.Errorf("heartbeat err, %w", err)
+	}
+	replicas, err := l.queries.ListLiveReplicas(ctx, l.ttl.Seconds())
+	if err != nil {
+		return fmt.Errorf("list replicas err, %w", err)
+	}
+	assigned := assignRegions(l.regionIDs, replicas, l.replicaID)
+
+	// Release regions assigned to other replicas, waiting for ongoing updates
+	isAssigned := make(map[string]bool, len(assigned))
+	for _, id := range assigned {
+		isAssigned[id] = true
+	}
+	l.mtx.Lock()
+	var releasing bool
+	for id := range l.owned {
+		releasing = releasing || !isAssigned[id]
+	}
+	l.mtx.Unlock()
+	if releasing {
+		l.useMtx.Lock()
+		defer l.useMtx.Unlock()
+	}
+	err = l.queries.ReleaseRegionLeases(ctx, feedpg.ReleaseRegionLeasesParams{
+		Owner: l.replicaID,
+		Keep:  assigned,
+	})
+	if err != nil {
+		return fmt.Errorf("release leases err, %w", err)
+	}
+
+	// Claim or renew leases of the assigned regions
+	claimed, err := l.queries.ClaimRegionLeases(ctx, feedpg.ClaimRegionLeasesParams{
+		Owner:      l.replicaID,
+		TtlSeconds: l.ttl.Seconds(),
+		RegionIds:  assigned,
+	})
+	if err != nil {
+		l.setOwned(ctx, nil, time.Time{})
+		return fmt.Errorf("claim leases err, %w", err)
+	}
+	l.setOwned(ctx, claimed, start.Add(l.ttl))
+	return nil
+}
+
+func (l *RegionLeases) setOwned(ctx context.Context, regionIDs []string, validUntil time.Time) {
+	l.mtx.Lock()
+	owned := make(map[string]bool, len(regionIDs))
+	changed := len(regionIDs) != len(l.owned)
+	for _, id := range regionIDs {
+		owned[id] = true
+		changed = changed || !l.owned[id]
+	}
+	if changed {
+		sorted := append([]string{}, regionIDs...)
+		sort.Strings(sorted)
+		Logger(ctx).Info("Owned regions changed",
+			"replica_id", l.replicaID, "regions", sorted)
+	}
+	l.owned = owned
+	l.validUntil = validUntil
+	onChange := l.onChange
+	l.mtx.Unlock()
+	ownedRegions.Set(float64(len(owned)))
+	if changed && onChange != nil {
+		onChange()
+	}
+}
+
+// release releases all leases of the replica and unregisters it, so that
+// other replicas can take over its regions without waiting for expiry.
+func (l *RegionLeases) release() {
+	l.useMtx.Lock()
+	defer l.useMtx.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	l.setOwned(ctx, nil, time.Time{})
+	err := l.queries.ReleaseRegionLeases(ctx, feedpg.ReleaseRegionLeasesParams{
+		Owner: l.replicaID,
+		Keep:  []string{},
+	})
+	if err == nil {
+		err = l.queries.DeleteReplica(ctx, l.replicaID)
+	}
+	if err != nil {
+		Logger(ctx).Error("Release region leases failed", "error", err)
+	}
+}
+
+// assignRegions returns the regions assigned to the replica, when the sorted
+// regions are dealt to the replicas in turn.
+func assignRegions(regionIDs, replicaIDs []string, replicaID string) []string {
+	replicaIDs = append([]string{}, replicaIDs...)
+	sort.Strings(replicaIDs)
+	idx := sort.SearchStrings(replicaIDs, replicaID)
+	if idx == len(replicaIDs) || replicaIDs[idx] != replicaID {
+		return []string{}
+	}
+	regionIDs = append([]string{}, regionIDs...)
+	sort.Strings(regionIDs)
+	assigned := []string{}
+	for i, id := range regionIDs {
+		if i%len(replicaIDs) == idx {
+			assigned = append(assigned, id)
+		}
+	}
+	return assigned
+}
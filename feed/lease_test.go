@@ -0,0 +1,201 @@
+package feed_test
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sebnyberg/policefeed/feed"
+	"github.com/sebnyberg/policefeed/feed/feedtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssignRegions(t *testing.T) {
+	regions := []string{"e", "d", "c", "b", "a"}
+	replicas := []string{"r2", "r1"}
+	require.Equal(t, []string{"a", "c", "e"}, feed.AssignRegions(regions, replicas, "r1"))
+	require.Equal(t, []string{"b", "d"}, feed.AssignRegions(regions, replicas, "r2"))
+	require.Empty(t, feed.AssignRegions(regions, replicas, "r3"))
+}
+
+func TestRegionLeases(t *testing.T) {
+	db := feedtest.OpenPostgres(t)
+	db.SetMaxOpenConns(5)
+	feedtest.TruncatePostgres(t, db)
+
+	regions := []string{"a", "b", "c", "d"}
+	type replica struct {
+		leases *feed.RegionLeases
+		cancel func()
+		done   chan struct{}
+	}
+	start := func(id string) *replica {
+		l := feed.NewRegionLeases(db, id, regions)
+		feed.SetRegionLeaseIntervals(l, 20*time.Millisecond, time.Second)
+		ctx, cancel := context.WithCancel(context.Background())
+		r := &replica{leases: l, cancel: cancel, done: make(chan struct{})}
+		go func() {
+			defer close(r.done)
+			if err := l.Run(ctx); err != nil {
+				t.Error(err)
+			}
+		}()
+		return r
+	}
+	owned := func(r *replica) []string {
+		var res []string
+		require.NoError(t, r.leases.Use(regions, func(owned []string) error {
+			res = owned
+			return nil
+		}))
+		sort.Strings(res)
+		return res
+	}
+	waitFor := func(r *replica, want []string) {
+		t.Helper()
+		require.Eventually(t, func() bool {
+			return assert.ObjectsAreEqual(want, owned(r))
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+
+	r1 := start("r1")
+	waitFor(r1, regions)
+
+	// Regions are rebalanced when a replica joins
+	r2 := start("r2")
+	waitFor(r1, []string{"a", "c"})
+	waitFor(r2, []string{"b", "d"})
+
+	// A region is never owned by two replicas at the same time
+	var mtx sync.Mutex
+	inUse := make(map[string]int)
+	use := func(r *replica) {
+		_ = r.leases.Use(regions, func(owned []string) error {
+			mtx.Lock()
+			for _, id := range owned {
+				inUse[id]++
+				if inUse[id] > 1 {
+					t.Errorf("region %v is owned twice", id)
+				}
+			}
+			mtx.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			mtx.Lock()
+			for _, id := range owned {
+				inUse[id]--
+			}
+			mtx.Unlock()
+			return nil
+		})
+	}
+
+	// Regions are taken over when a replica leaves
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, r := range []*replica{r1, r2} {
+		wg.Add(1)
+		go func(r *replica) {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					use(r)
+				}
+			}
+		}(r)
+	}
+	r2.cancel()
+	<-r2.done
+	waitFor(r1, regions)
+	close(stop)
+	wg.Wait()
+	r1.cancel()
+	<-r1.done
+}
+
+func TestRegionLeasesFence(t *testing.T) {
+	db := feedtest.OpenPostgres(t)
+	feedtest.TruncatePostgres(t, db)
+
+	ctx := context.Background()
+	regions := []string{"a", "b"}
+	l := feed.NewRegionLeases(db, "r1", regions)
+	feed.SetRegionLeaseIntervals(l, 20*time.Millisecond, time.Second)
+	target := l.Fence(feed.NewMemoryStorage(), regions)
+	events := []feed.Event{{
+		ID:          feed.NewEventID("https://polisen.se/a"),
+		Revision:    1,
+		ContentHash: []byte("a"),
+	}}
+
+	// Events are not stored before the leases are claimed
+	require.ErrorIs(t, target.CreateEvents(ctx, events), feed.ErrLeaseLost)
+
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := l.Run(runCtx); err != nil {
+			t.Error(err)
+		}
+	}()
+	require.Eventually(t, func() bool {
+		return l.Check(ctx, regions) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, target.CreateEvents(ctx, events))
+
+	// Nor after the leases have been lost
+	cancel()
+	<-done
+	require.ErrorIs(t, target.CreateEvents(ctx, events), feed.ErrLeaseLost)
+}
+
+func TestRegionLeasesFenceEventStorage(t *testing.T) {
+	db := feedtest.OpenPostgres(t)
+	feedtest.TruncatePostgres(t, db)
+
+	ctx := context.Background()
+	regions := []string{"a", "b"}
+	l := feed.NewRegionLeases(db, "r1", regions)
+	feed.SetRegionLeaseIntervals(l, time.Hour, time.Minute)
+	storage := feed.NewEventStorage(db)
+	target := l.Fence(storage, regions)
+	evt := feed.Event{
+		ID:          feed.NewEventID("https://polisen.se/a"),
+		Region:      "Händelser RSS - Blekinge",
+		Revision:    1,
+		CreateTime:  time.Date(2022, 2, 9, 12, 0, 0, 0, time.UTC),
+		PublishTime: time.Date(2022, 2, 9, 12, 0, 0, 0, time.UTC),
+		ContentHash: []byte("a"),
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := l.Run(runCtx); err != nil {
+			t.Error(err)
+		}
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	require.Eventually(t, func() bool {
+		return l.Check(ctx, regions) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// The lease is taken over before the replica learns about it
+	_, err := db.Exec("update region_lease set owner = 'r2' where region_id = 'b'")
+	require.NoError(t, err)
+	require.ErrorIs(t, target.CreateEvents(ctx, []feed.Event{evt}), feed.ErrLeaseLost)
+	got, err := storage.ListUniqueEvents(ctx, []uuid.UUID{evt.ID})
+	require.NoError(t, err)
+	require.Empty(t, got)
+}
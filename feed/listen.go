@@ -0,0 +1,128 @@
+package feed
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/stdlib"
+	"github.com/sebnyberg/policefeed/feed/feedpg"
+)
+
+// EventCreatedChannel is the Postgres notification channel on which the
+// EventStorage publishes created event revisions. The payload is a JSON
+// object with the event "id", "revision" and "region", e.g.
+//
+//	{"id": "4f1c...", "revision": 2, "region": "Händelser RSS - Blekinge"}
+const EventCreatedChannel = "police_event_created"
+
+type eventCreatedPayload struct {
+	ID       uuid.UUID `json:"id"`
+	Revision int32     `json:"revision"`
+	Region   string    `json:"region"`
+}
+
+// EventListener listens for event revisions created in the Postgres database
+// by any process. Use ListenEvents to create an EventListener.
+type EventListener struct {
+	events chan Event
+	err    error
+}
+
+// ListenEvents starts listening on the EventCreatedChannel using a dedicated
+// connection from db. Once ListenEvents returns, all subsequently created
+// events are sent on the Events channel.
+//
+// Listening stops when the context is cancelled or the connection fails.
+func ListenEvents(ctx context.Context, db *sql.DB) (*EventListener, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("open conn err, %w", err)
+	}
+	l := &EventListener{events: make(chan Event, 100)}
+	queries := feedpg.New(db)
+	ready := make(chan error, 1)
+	go func() {
+		defer close(l.events)
+		defer conn.Close()
+		err := conn.Raw(func(driverConn interface{}) error {
+			pgConn := driverConn.(*stdlib.Conn).Conn()
+			_, err := pgConn.Exec(ctx, "listen "+pgx.Identifier{EventCreatedChannel}.Sanitize())
+			ready <- err
+			if err != nil {
+				return err
+			}
+			// The connection is returned to the pool afterwards
+			defer pgConn.Exec(context.Background(), "unlisten *")
+			return l.listen(ctx, pgConn, queries)
+		})
+		select {
+		case ready <- err: // failed before listening
+		default:
+		}
+		if ctx.Err() == nil {
+			l.err = err
+		}
+	}()
+	if err := <-ready; err != nil {
+		return nil, fmt.Errorf("listen err, %w", err)
+	}
+	return l, nil
+}
+
+func (l *EventListener) listen(ctx context.Context, conn *pgx.Conn, queries *feedpg.Queries) error {
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return fmt.Errorf("wait for notification err, %w", err)
+		}
+		var payload eventCreatedPayload
+		if err := json.Unmarshal([]byte(n.Payload), &payload); err != nil {
+			return fmt.Errorf("parse notification err, %w", err)
+		}
+		row, err := queries.GetEvent(ctx, feedpg.GetEventParams{
+			ID:       payload.ID,
+			Revision: payload.Revision,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			continue // removed since it was created
+		}
+		if err != nil {
+			return fmt.Errorf("get event err, %w", err)
+		}
+		evt := Event{
+			ID:              row.ID,
+			URL:             row.Url,
+			Title:           row.Title,
+			Region:          row.Region,
+			Description:     row.Description,
+			ArticleContents: row.ArticleContents,
+			Revision:        row.Revision,
+			CreateTime:      row.CreateTime,
+			PublishTime:     row.PublishTime,
+			ContentHash:     row.ContentHash,
+			Removed:         row.Removed,
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case l.events <- evt:
+		}
+	}
+}
+
+// Events returns the channel of created events. The channel is closed when
+// listening stops.
+func (l *EventListener) Events() <-chan Event {
+	return l.events
+}
+
+// Err returns the error that stopped the listener, if any. It should be
+// called after the Events channel has been closed.
+func (l *EventListener) Err() error {
+	return l.err
+}
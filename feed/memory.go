@@ -0,0 +1,178 @@
+package feed
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var _ EventListerCreator = new(MemoryStorage)
+
+var _ LatestEventLister = new(MemoryStorage)
+
+var _ ChangeLister = new(MemoryStorage)
+
+var _ EventSeenMarker = new(MemoryStorage)
+
+// MemoryStorage keeps all event revisions in memory. It is meant for local
+// runs and tests, all events are lost when the process exits.
+type MemoryStorage struct {
+	// revisions contains all revisions of an event ordered by revision.
+	revisions map[uuid.UUID][]Event
+	// seen contains the first and last seen time of each event.
+	seen map[uuid.UUID]seenTimes
+	// changes contains all revisions in the order they were created, and
+	// seq is the Seq of the cursors of the last created batch.
+	changes []EventChange
+	seq     int64
+	mtx     sync.RWMutex
+}
+
+// seenTimes are the times when an event was first and last seen.
+type seenTimes struct {
+	first, last time.Time
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		revisions: make(map[uuid.UUID][]Event),
+		seen:      make(map[uuid.UUID]seenTimes),
+	}
+}
+
+// ListUniqueEvents lists the most recent revision of each event. If ids is
+// non-empty, it is used to filter the result.
+func (s *MemoryStorage) ListUniqueEvents(
+	ctx context.Context,
+	ids []uuid.UUID,
+) ([]Event, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	if len(ids) == 0 {
+		ids = keys(s.revisions)
+	}
+	events := make([]Event, 0, len(ids))
+	for _, id := range ids {
+		revs, exists := s.revisions[id]
+		if !exists {
+			continue
+		}
+		evt := revs[len(revs)-1]
+		seen := s.seen[id]
+		evt.FirstSeenTime, evt.LastSeenTime = seen.first, seen.last
+		events = append(events, evt)
+	}
+	return events, nil
+}
+
+func (s *MemoryStorage) ListLatestEvents(
+	ctx context.Context,
+	limit int,
+) ([]Event, error) {
+	events, err := s.ListUniqueEvents(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].PublishTime.After(events[j].PublishTime)
+	})
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	return events, nil
+}
+
+func (s *MemoryStorage) ListEventChanges(
+	ctx context.Context,
+	after ChangeCursor,
+	limit int,
+) ([]EventChange, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	since, isStart := after.Since()
+	var changes []EventChange
+	for _, change := range s.changes {
+		if len(changes) == limit {
+			break
+		}
+		if isStart {
+			if !change.CreateTime.After(since) {
+				continue
+			}
+		} else if !after.Before(change.Cursor) {
+			continue
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// CreateEvents adds the provided event revisions. Either all events are
+// created, or none of them are.
+func (s *MemoryStorage) CreateEvents(ctx context.Context, events []Event) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	// Validate that no revision already exists
+	type key struct {
+		id       uuid.UUID
+		revision int32
+	}
+	seen := make(map[key]struct{}, len(events))
+	for _, evt := range events {
+		k := key{evt.ID, evt.Revision}
+		if _, exists := seen[k]; exists {
+			return fmt.Errorf("duplicate revision %v of event %v", evt.Revision, evt.ID)
+		}
+		seen[k] = struct{}{}
+		for _, rev := range s.revisions[evt.ID] {
+			if rev.Revision == evt.Revision {
+				return fmt.Errorf("revision %v of event %v already exists", evt.Revision, evt.ID)
+			}
+		}
+	}
+
+	s.seq++
+	batch := make([]EventChange, len(events))
+	for i, evt := range events {
+		evt.ContentHash = append([]byte(nil), evt.ContentHash...)
+		revs := append(s.revisions[evt.ID], evt)
+		sort.Slice(revs, func(i, j int) bool {
+			return revs[i].Revision < revs[j].Revision
+		})
+		s.revisions[evt.ID] = revs
+		batch[i] = EventChange{
+			Event:  evt,
+			Cursor: ChangeCursor{Seq: s.seq, ID: evt.ID, Revision: evt.Revision},
+		}
+	}
+	sort.Slice(batch, func(i, j int) bool {
+		return batch[i].Cursor.Before(batch[j].Cursor)
+	})
+	s.changes = append(s.changes, batch...)
+	return nil
+}
+
+// MarkEventsSeen records that the events were seen in the RSS feed at
+// seenTime.
+func (s *MemoryStorage) MarkEventsSeen(
+	ctx context.Context, ids []uuid.UUID, seenTime time.Time,
+) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for _, id := range ids {
+		seen, exists := s.seen[id]
+		if !exists {
+			seen.first = seenTime
+		}
+		if seenTime.After(seen.last) {
+			seen.last = seenTime
+		}
+		s.seen[id] = seen
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package feed
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const metricsNamespace = "policefeed"
+
+var (
+	fetchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "rss_fetch_duration_seconds",
+		Help:      "Time to fetch and parse the RSS feed of a region.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"region"})
+
+	fetchResponses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "rss_fetch_responses_total",
+		Help:      "Responses from the RSS feed of a region by HTTP status code.",
+	}, []string{"region", "code"})
+
+	parseFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "rss_parse_failures_total",
+		Help:      "RSS feeds of a region which could not be parsed.",
+	}, []string{"region"})
+
+	eventsCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "update_events_created_total",
+		Help:      "Events created by updates, excluding new revisions of existing events.",
+	})
+
+	eventsRevised = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "update_events_revised_total",
+		Help:      "New revisions of existing events created by updates.",
+	})
+
+	eventsRemoved = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "update_events_removed_total",
+		Help:      "Tombstone revisions created by updates for events removed from the feed.",
+	})
+
+	lastUpdateTime = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "update_last_success_timestamp_seconds",
+		Help:      "Unix time of the last update which stored the events of a region.",
+	}, []string{"region"})
+
+	isLeader = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "leader",
+		Help:      "Whether this process is the leader which runs updates, 1 if it is.",
+	})
+
+	ownedRegions = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "owned_regions",
+		Help:      "Number of regions leased by this process when regions are sharded.",
+	})
+
+	archivedRevisions = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "retention_archived_revisions_total",
+		Help:      "Event revisions moved to the archive table by the retention policy.",
+	})
+
+	copyDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "postgres_copy_duration_seconds",
+		Help:      "Time to copy created events into Postgres.",
+		Buckets:   prometheus.DefBuckets,
+	})
+)
@@ -0,0 +1,54 @@
+package feed
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateMetrics(t *testing.T) {
+	events := []Event{
+		{ID: NewEventID("a"), URL: "a", ContentHash: []byte("a")},
+		{ID: NewEventID("b"), URL: "b", ContentHash: []byte("b")},
+	}
+	source := NewRSSAdapter([]string{"skane", "blekinge"},
+		func(ctx context.Context, regionIDs []string) ([]Event, error) {
+			return append([]Event(nil), events...),
+				RegionErrors{"blekinge": errors.New("unexpected response code 503")}
+		},
+	)
+	created := testutil.ToFloat64(eventsCreated)
+	revised := testutil.ToFloat64(eventsRevised)
+	lastUpdateTime.Reset()
+
+	up := NewUpdater()
+	_, err := up.Update(context.Background(), source, NewMemoryStorage())
+	require.NoError(t, err)
+
+	require.Equal(t, created+2, testutil.ToFloat64(eventsCreated))
+	require.Equal(t, revised, testutil.ToFloat64(eventsRevised))
+	require.NotZero(t, testutil.ToFloat64(lastUpdateTime.WithLabelValues("skane")))
+	require.Equal(t, 1, testutil.CollectAndCount(lastUpdateTime))
+}
+
+// regionSource reads the regions of a source which is not an RSSAdapter.
+type regionSource struct {
+	EventLister
+	regionIDs []string
+}
+
+func (s regionSource) RegionIDs() []string { return s.regionIDs }
+
+func TestUpdateMetricsRegionReader(t *testing.T) {
+	lastUpdateTime.Reset()
+	source := regionSource{EventLister: NewMemoryStorage(), regionIDs: []string{"uppsala-lan"}}
+
+	_, err := NewUpdater().Update(context.Background(), source, NewMemoryStorage())
+	require.NoError(t, err)
+
+	require.NotZero(t, testutil.ToFloat64(lastUpdateTime.WithLabelValues("uppsala-lan")))
+	require.Equal(t, 1, testutil.CollectAndCount(lastUpdateTime))
+}
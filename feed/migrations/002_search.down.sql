@@ -0,0 +1,9 @@
+begin;
+
+drop index if exists police_event_search_idx;
+
+alter table police_event drop column if exists search_vector;
+
+alter table police_event drop column if exists article_contents;
+
+end transaction;
@@ -0,0 +1,17 @@
+begin;
+
+alter table police_event
+  add column if not exists article_contents text not null default '';
+
+alter table police_event
+  add column if not exists search_vector tsvector
+    generated always as (
+      setweight(to_tsvector('swedish', title), 'A') ||
+      setweight(to_tsvector('swedish', description), 'B') ||
+      setweight(to_tsvector('swedish', article_contents), 'C')
+    ) stored;
+
+create index if not exists police_event_search_idx
+  on police_event using gin (search_vector);
+
+end transaction;
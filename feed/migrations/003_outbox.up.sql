@@ -0,0 +1,23 @@
+begin;
+
+create table if not exists event_outbox (
+  id bigserial not null,
+  event_id uuid not null,
+  revision int not null,
+  idempotency_key text not null,
+  create_time timestamptz not null default now(),
+  next_attempt_time timestamptz not null default now(),
+  deliver_time timestamptz,
+  attempts int not null default 0,
+  last_error text,
+  constraint event_outbox_pk
+    primary key (id),
+  constraint event_outbox_idempotency_key_uq
+    unique (idempotency_key)
+);
+
+create index if not exists event_outbox_pending_idx
+  on event_outbox (next_attempt_time)
+  where deliver_time is null;
+
+end transaction;
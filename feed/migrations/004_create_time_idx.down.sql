@@ -0,0 +1,5 @@
+begin;
+
+drop index if exists police_event_create_time_idx;
+
+end transaction;
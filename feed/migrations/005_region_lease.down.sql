@@ -0,0 +1,6 @@
+begin;
+
+drop table if exists region_lease;
+drop table if exists updater_replica;
+
+end transaction;
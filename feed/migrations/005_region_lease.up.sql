@@ -0,0 +1,18 @@
+begin;
+
+create table if not exists updater_replica (
+  id text not null,
+  heartbeat_time timestamptz not null,
+  constraint updater_replica_pk
+    primary key (id)
+);
+
+create table if not exists region_lease (
+  region_id text not null,
+  owner text not null,
+  expire_time timestamptz not null,
+  constraint region_lease_pk
+    primary key (region_id)
+);
+
+end transaction;
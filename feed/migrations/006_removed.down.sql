@@ -0,0 +1,5 @@
+begin;
+
+alter table police_event drop column if exists removed;
+
+end transaction;
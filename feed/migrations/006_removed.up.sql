@@ -0,0 +1,8 @@
+begin;
+
+-- removed marks tombstone revisions of events that were retracted from the
+-- RSS feed
+alter table police_event
+  add column if not exists removed boolean not null default false;
+
+end transaction;
@@ -0,0 +1,23 @@
+begin;
+
+-- police_event_seen contains the times when each event was first and last
+-- seen in the RSS feed
+create table if not exists police_event_seen (
+  id uuid not null,
+  first_seen_time timestamptz not null,
+  last_seen_time timestamptz not null,
+  constraint police_event_seen_pk
+    primary key (id)
+);
+
+create index if not exists police_event_seen_last_seen_time_idx
+  on police_event_seen (last_seen_time);
+
+-- Existing events were seen at least when their revisions were created
+insert into police_event_seen (id, first_seen_time, last_seen_time)
+select id, min(create_time), max(create_time)
+from police_event
+group by id
+on conflict (id) do nothing;
+
+end transaction;
@@ -0,0 +1,5 @@
+begin;
+
+drop table if exists police_event_archive;
+
+end transaction;
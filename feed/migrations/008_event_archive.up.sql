@@ -0,0 +1,22 @@
+begin;
+
+-- police_event_archive contains event revisions moved out of police_event by
+-- the retention policy
+create table if not exists police_event_archive (
+  id uuid not null,
+  url text not null,
+  title text not null,
+  region text not null,
+  description text not null,
+  article_contents text not null,
+  publish_time timestamptz not null,
+  create_time timestamptz not null,
+  content_hash bytea not null,
+  revision int not null,
+  removed boolean not null,
+  archive_time timestamptz not null default now(),
+  constraint police_event_archive_pk
+    primary key (id, revision)
+);
+
+end transaction;
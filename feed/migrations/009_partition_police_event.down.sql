@@ -0,0 +1,10 @@
+begin;
+
+drop trigger if exists police_event_copy on police_event;
+drop function if exists police_event_copy();
+
+-- Drops all partitions
+drop table if exists police_event_partitioned;
+drop table if exists police_event_revision;
+
+end transaction;
@@ -0,0 +1,109 @@
+begin;
+
+-- police_event is moved to a table which is range-partitioned by publish
+-- month, in steps which keep the table available:
+--
+--   009 creates the partitioned table, with a partition for every month of
+--       the existing events, and a default partition for any publish time
+--       without a monthly partition. From then on, a trigger copies every
+--       revision inserted into or deleted from police_event.
+--   012 copies the existing events while they are still being written.
+--   013 swaps the tables, which are then equal, so no events are copied
+--       while writes are blocked.
+--
+-- The primary key of a partitioned table must contain the partition key, see
+-- police_event_revision for the uniqueness of revisions
+create table if not exists police_event_partitioned (
+  id uuid not null,
+  url text not null,
+  title text not null,
+  region text not null,
+  description text not null,
+  publish_time timestamptz not null,
+  create_time timestamptz not null,
+  content_hash bytea not null,
+  revision int not null,
+  article_contents text not null default '',
+  search_vector tsvector
+    generated always as (
+      setweight(to_tsvector('swedish', title), 'A') ||
+      setweight(to_tsvector('swedish', description), 'B') ||
+      setweight(to_tsvector('swedish', article_contents), 'C')
+    ) stored,
+  removed boolean not null default false,
+  constraint police_event_partitioned_pk
+    primary key (id, revision, publish_time)
+) partition by range (publish_time);
+
+create index if not exists police_event_partitioned_search_idx
+  on police_event_partitioned using gin (search_vector);
+create index if not exists police_event_partitioned_create_time_idx
+  on police_event_partitioned (create_time, id, revision);
+
+-- police_event_revision makes revisions unique across partitions
+create table if not exists police_event_revision (
+  id uuid not null,
+  revision int not null,
+  constraint police_event_revision_pk
+    primary key (id, revision)
+);
+
+create table if not exists police_event_default
+  partition of police_event_partitioned default;
+
+-- Monthly partitions from the first publish month up to and including the
+-- next month. Later months are created ahead of time by EnsurePartitions.
+do $$
+declare
+  month timestamptz;
+  last timestamptz := date_trunc('month', now() at time zone 'UTC') at time zone 'UTC'
+    + interval '1 month';
+begin
+  select coalesce(
+    min(date_trunc('month', publish_time at time zone 'UTC') at time zone 'UTC'),
+    last
+  )
+  into month
+  from police_event;
+  while month <= last loop
+    execute format(
+      'create table if not exists police_event_p%s
+         partition of police_event_partitioned
+         for values from (%L) to (%L)',
+      to_char(month at time zone 'UTC', 'YYYY_MM'),
+      month,
+      month + interval '1 month'
+    );
+    month := month + interval '1 month';
+  end loop;
+end $$;
+
+-- Creating the trigger waits for running writes to police_event, so every
+-- revision is either copied by the trigger, or visible to 012
+create or replace function police_event_copy() returns trigger
+language plpgsql as $$
+begin
+  if tg_op = 'DELETE' then
+    delete from police_event_partitioned
+    where id = old.id and revision = old.revision
+      and publish_time = old.publish_time;
+    return null;
+  end if;
+  insert into police_event_partitioned (id, url, title, region, description,
+    publish_time, create_time, content_hash, revision, article_contents, removed)
+  values (new.id, new.url, new.title, new.region, new.description,
+    new.publish_time, new.create_time, new.content_hash, new.revision,
+    new.article_contents, new.removed)
+  on conflict do nothing;
+  insert into police_event_revision (id, revision)
+  values (new.id, new.revision)
+  on conflict do nothing;
+  return null;
+end
+$$;
+
+create trigger police_event_copy
+  after insert or delete on police_event
+  for each row execute function police_event_copy();
+
+end transaction;
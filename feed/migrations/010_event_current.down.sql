@@ -0,0 +1,8 @@
+begin;
+
+drop trigger if exists police_event_set_current on police_event;
+drop function if exists police_event_set_current();
+drop table if exists police_event_current;
+drop function if exists police_event_type(text);
+
+end transaction;
@@ -0,0 +1,80 @@
+begin;
+
+-- police_event_type returns the event type given by the title, e.g.
+-- "Trafikolycka, vilt" for "08 februari 17:35, Trafikolycka, vilt, Karlskrona",
+-- see Event.Type
+create or replace function police_event_type(title text) returns text
+language sql immutable as $$
+  select case
+    when cardinality(p.parts) < 3 then ''
+    else array_to_string(p.parts[2:cardinality(p.parts) - 1], ', ')
+  end
+  from (select string_to_array(title, ', ') as parts) p
+$$;
+
+-- police_event_current contains the most recent revision of each event
+create table if not exists police_event_current (
+  id uuid not null,
+  url text not null,
+  title text not null,
+  region text not null,
+  type text not null,
+  description text not null,
+  article_contents text not null,
+  publish_time timestamptz not null,
+  create_time timestamptz not null,
+  content_hash bytea not null,
+  revision int not null,
+  removed boolean not null,
+  constraint police_event_current_pk
+    primary key (id)
+);
+
+create index if not exists police_event_current_publish_time_idx
+  on police_event_current (publish_time);
+create index if not exists police_event_current_region_idx
+  on police_event_current (region, publish_time);
+create index if not exists police_event_current_type_idx
+  on police_event_current (type, publish_time);
+
+-- Keep police_event_current up to date in the transaction which inserts the
+-- revision
+create or replace function police_event_set_current() returns trigger
+language plpgsql as $$
+begin
+  insert into police_event_current (id, url, title, region, type, description,
+    article_contents, publish_time, create_time, content_hash, revision, removed)
+  values (new.id, new.url, new.title, new.region, police_event_type(new.title),
+    new.description, new.article_contents, new.publish_time, new.create_time,
+    new.content_hash, new.revision, new.removed)
+  on conflict (id) do update
+  set url = excluded.url,
+    title = excluded.title,
+    region = excluded.region,
+    type = excluded.type,
+    description = excluded.description,
+    article_contents = excluded.article_contents,
+    publish_time = excluded.publish_time,
+    create_time = excluded.create_time,
+    content_hash = excluded.content_hash,
+    revision = excluded.revision,
+    removed = excluded.removed
+  where police_event_current.revision < excluded.revision;
+  return null;
+end
+$$;
+
+create trigger police_event_set_current
+  after insert on police_event
+  for each row execute function police_event_set_current();
+
+insert into police_event_current (id, url, title, region, type, description,
+  article_contents, publish_time, create_time, content_hash, revision, removed)
+select distinct on (id) id, url, title, region, police_event_type(title),
+  description, article_contents, publish_time, create_time, content_hash,
+  revision, removed
+from police_event
+order by id, revision desc
+on conflict (id) do nothing;
+
+end transaction;
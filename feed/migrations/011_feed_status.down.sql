@@ -0,0 +1,5 @@
+begin;
+
+drop table if exists feed_status;
+
+end transaction;
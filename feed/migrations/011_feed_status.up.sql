@@ -0,0 +1,15 @@
+begin;
+
+-- feed_status contains the status of the RSS feed of each region, as last
+-- fetched by any replica
+create table if not exists feed_status (
+  region_id text not null,
+  last_attempt timestamptz not null,
+  last_success timestamptz,
+  item_count int not null default 0,
+  last_error text not null default '',
+  constraint feed_status_pk
+    primary key (region_id)
+);
+
+end transaction;
@@ -0,0 +1,5 @@
+begin;
+
+truncate police_event_partitioned, police_event_revision;
+
+end transaction;
@@ -0,0 +1,21 @@
+begin;
+
+-- Copy the existing events into the partitioned table, events written
+-- meanwhile are copied by the trigger of 009. Reading police_event does not
+-- block inserts. The rows are locked so that they are not archived before
+-- the copy commits, which the trigger could not copy; archiving skips locked
+-- rows.
+insert into police_event_partitioned (id, url, title, region, description,
+  publish_time, create_time, content_hash, revision, article_contents, removed)
+select id, url, title, region, description, publish_time, create_time,
+  content_hash, revision, article_contents, removed
+from police_event
+for share
+on conflict do nothing;
+
+insert into police_event_revision (id, revision)
+select id, revision
+from police_event
+on conflict do nothing;
+
+end transaction;
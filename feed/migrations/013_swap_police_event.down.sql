@@ -0,0 +1,85 @@
+begin;
+
+create table police_event_unpartitioned (
+  id uuid not null,
+  url text not null,
+  title text not null,
+  region text not null,
+  description text not null,
+  publish_time timestamptz not null,
+  create_time timestamptz not null,
+  content_hash bytea not null,
+  revision int not null,
+  article_contents text not null default '',
+  search_vector tsvector
+    generated always as (
+      setweight(to_tsvector('swedish', title), 'A') ||
+      setweight(to_tsvector('swedish', description), 'B') ||
+      setweight(to_tsvector('swedish', article_contents), 'C')
+    ) stored,
+  removed boolean not null default false,
+  constraint police_event_unpartitioned_pk
+    primary key (id, revision)
+);
+
+insert into police_event_unpartitioned (id, url, title, region, description,
+  publish_time, create_time, content_hash, revision, article_contents, removed)
+select id, url, title, region, description, publish_time, create_time,
+  content_hash, revision, article_contents, removed
+from police_event;
+
+create index if not exists police_event_unpartitioned_search_idx
+  on police_event_unpartitioned using gin (search_vector);
+create index if not exists police_event_unpartitioned_create_time_idx
+  on police_event_unpartitioned (create_time, id, revision);
+
+-- The partitioned table is kept for 012 to empty and 009 to drop
+drop trigger if exists police_event_set_current on police_event;
+alter table police_event rename to police_event_partitioned;
+alter table police_event_partitioned
+  rename constraint police_event_pk to police_event_partitioned_pk;
+alter index police_event_search_idx
+  rename to police_event_partitioned_search_idx;
+alter index police_event_create_time_idx
+  rename to police_event_partitioned_create_time_idx;
+
+alter table police_event_unpartitioned rename to police_event;
+alter table police_event
+  rename constraint police_event_unpartitioned_pk to police_event_pk;
+alter index police_event_unpartitioned_search_idx
+  rename to police_event_search_idx;
+alter index police_event_unpartitioned_create_time_idx
+  rename to police_event_create_time_idx;
+
+create trigger police_event_set_current
+  after insert on police_event
+  for each row execute function police_event_set_current();
+
+-- Keep the partitioned table equal until it is emptied by 012, as after 009
+create or replace function police_event_copy() returns trigger
+language plpgsql as $$
+begin
+  if tg_op = 'DELETE' then
+    delete from police_event_partitioned
+    where id = old.id and revision = old.revision
+      and publish_time = old.publish_time;
+    return null;
+  end if;
+  insert into police_event_partitioned (id, url, title, region, description,
+    publish_time, create_time, content_hash, revision, article_contents, removed)
+  values (new.id, new.url, new.title, new.region, new.description,
+    new.publish_time, new.create_time, new.content_hash, new.revision,
+    new.article_contents, new.removed)
+  on conflict do nothing;
+  insert into police_event_revision (id, revision)
+  values (new.id, new.revision)
+  on conflict do nothing;
+  return null;
+end
+$$;
+
+create trigger police_event_copy
+  after insert or delete on police_event
+  for each row execute function police_event_copy();
+
+end transaction;
@@ -0,0 +1,23 @@
+begin;
+
+-- police_event_partitioned holds the same revisions as police_event since 012,
+-- kept equal by the trigger of 009, so writes are only blocked for the swap
+lock table police_event in access exclusive mode;
+
+-- Drops the police_event_copy and police_event_set_current triggers
+drop table police_event;
+drop function if exists police_event_copy();
+
+alter table police_event_partitioned rename to police_event;
+alter table police_event
+  rename constraint police_event_partitioned_pk to police_event_pk;
+alter index police_event_partitioned_search_idx
+  rename to police_event_search_idx;
+alter index police_event_partitioned_create_time_idx
+  rename to police_event_create_time_idx;
+
+create trigger police_event_set_current
+  after insert on police_event
+  for each row execute function police_event_set_current();
+
+end transaction;
@@ -0,0 +1,6 @@
+begin;
+
+drop index if exists police_event_change_idx;
+alter table police_event drop column if exists change_txid;
+
+end transaction;
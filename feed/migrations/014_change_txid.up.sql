@@ -0,0 +1,15 @@
+begin;
+
+-- change_txid is the ID of the transaction which created the revision. Only
+-- revisions of transactions which are older than all running transactions
+-- are listed as changes, so that revisions are listed in the order they were
+-- committed, see ChangeCursor. Existing revisions are ordered first.
+alter table police_event
+  add column if not exists change_txid bigint not null default 0;
+alter table police_event
+  alter column change_txid set default txid_current();
+
+create index if not exists police_event_change_idx
+  on police_event (change_txid, id, revision);
+
+end transaction;
@@ -0,0 +1,177 @@
+package feed
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/sebnyberg/policefeed/feed/feedpg"
+)
+
+// Notification notifies about a created event revision.
+type Notification struct {
+	// IdempotencyKey is unique to the event revision, and stays the same when
+	// a notification is delivered more than once.
+	IdempotencyKey string
+	Event          Event
+}
+
+// Notifier delivers notifications about created events.
+type Notifier interface {
+	Notify(ctx context.Context, notifications []Notification) error
+}
+
+// OutboxRelay delivers notifications for events created in the Postgres
+// EventStorage.
+//
+// EventStorage.CreateEvents writes an entry to the event_outbox table in the
+// same transaction as the events. The relay delivers pending entries to all
+// notifiers and marks them as done, so notifications are not lost if the
+// process crashes right after events are created. Delivery is at-least-once:
+// if any notifier fails, the batch is retried for all notifiers with
+// exponential backoff.
+//
+// Entries are claimed for a limited time before they are delivered, so that
+// no transaction or row lock is held while notifiers are called. Entries of a
+// relay which crashes during delivery are retried once the claim expires.
+type OutboxRelay struct {
+	queries      *feedpg.Queries
+	notifiers    []Notifier
+	batchSize    int
+	pollInterval time.Duration
+	// claimTimeout is how long claimed entries are reserved for delivery,
+	// which also limits the time spent notifying.
+	claimTimeout time.Duration
+	// retention is how long delivered entries are kept in the outbox.
+	retention time.Duration
+}
+
+func NewOutboxRelay(db *sql.DB, notifiers ...Notifier) *OutboxRelay {
+	return &OutboxRelay{
+		queries:      feedpg.New(db),
+		notifiers:    notifiers,
+		batchSize:    100,
+		pollInterval: 5 * time.Second,
+		claimTimeout: 5 * time.Minute,
+		retention:    7 * 24 * time.Hour,
+	}
+}
+
+// Run relays pending outbox entries until the context is cancelled.
+//
+// Without notifiers, entries are not delivered. They are instead removed once
+// they are older than the retention period, so that the outbox does not grow
+// without bounds.
+func (r *OutboxRelay) Run(ctx context.Context) error {
+	lastPrune := time.Time{}
+	for {
+		var n int
+		if len(r.notifiers) > 0 {
+			var err error
+			if n, err = r.relayBatch(ctx); err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				Logger(ctx).Error("Relay outbox failed", "error", err)
+			}
+		}
+		if time.Since(lastPrune) > time.Hour {
+			r.prune(ctx)
+			lastPrune = time.Now()
+		}
+		if n == r.batchSize {
+			continue // more entries are likely pending
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(r.pollInterval):
+		}
+	}
+}
+
+// prune removes delivered entries which are older than the retention period,
+// and undelivered entries as well when there are no notifiers.
+func (r *OutboxRelay) prune(ctx context.Context) {
+	before := time.Now().Add(-r.retention)
+	pruned, err := r.queries.DeleteDeliveredOutbox(ctx, before)
+	if err == nil && len(r.notifiers) == 0 {
+		var undelivered int64
+		undelivered, err = r.queries.DeleteUndeliveredOutbox(ctx, before)
+		pruned += undelivered
+	}
+	if err != nil && ctx.Err() == nil {
+		Logger(ctx).Error("Prune outbox failed", "error", err)
+	} else if pruned > 0 {
+		Logger(ctx).Info("Pruned outbox entries", "count", pruned)
+	}
+}
+
+// relayBatch claims a batch of pending entries, delivers them and returns the
+// number of entries in the batch. Entries claimed by other relays are skipped,
+// so that several relays may run concurrently.
+func (r *OutboxRelay) relayBatch(ctx context.Context) (int, error) {
+	rows, err := r.queries.ClaimOutboxEvents(ctx, feedpg.ClaimOutboxEventsParams{
+		ClaimSeconds: r.claimTimeout.Seconds(),
+		MaxResults:   int32(r.batchSize),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("claim outbox events err, %w", err)
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]int64, len(rows))
+	notifications := make([]Notification, len(rows))
+	for i, row := range rows {
+		ids[i] = row.OutboxID
+		notifications[i] = Notification{
+			IdempotencyKey: row.IdempotencyKey,
+			Event: Event{
+				ID:              row.ID,
+				URL:             row.Url,
+				Title:           row.Title,
+				Region:          row.Region,
+				Description:     row.Description,
+				ArticleContents: row.ArticleContents,
+				Revision:        row.Revision,
+				CreateTime:      row.CreateTime,
+				PublishTime:     row.PublishTime,
+				ContentHash:     row.ContentHash,
+				Removed:         row.Removed,
+			},
+		}
+	}
+
+	// Give up before the claim expires, so that entries are not delivered by
+	// another relay at the same time
+	notifyCtx, cancel := context.WithTimeout(ctx, r.claimTimeout)
+	defer cancel()
+	var notifyErr error
+	for _, n := range r.notifiers {
+		if err := n.Notify(notifyCtx, notifications); err != nil {
+			notifyErr = err
+			break
+		}
+	}
+	if ctx.Err() != nil {
+		// The entries are retried when the claim expires
+		return 0, ctx.Err()
+	}
+	if notifyErr != nil {
+		err = r.queries.MarkOutboxFailed(ctx, feedpg.MarkOutboxFailedParams{
+			LastError: notifyErr.Error(),
+			Ids:       ids,
+		})
+		if err != nil {
+			return 0, fmt.Errorf("mark outbox failed err, %w", err)
+		}
+		return len(rows), fmt.Errorf("notify err, %w", notifyErr)
+	}
+	if err := r.queries.MarkOutboxDelivered(ctx, ids); err != nil {
+		return 0, fmt.Errorf("mark outbox delivered err, %w", err)
+	}
+	return len(rows), nil
+}
@@ -0,0 +1,81 @@
+package feed_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sebnyberg/policefeed/feed"
+	"github.com/sebnyberg/policefeed/feed/feedtest"
+	"github.com/stretchr/testify/require"
+)
+
+// notifierFunc adapts a function to a feed.Notifier.
+type notifierFunc func(ctx context.Context, notifications []feed.Notification) error
+
+func (f notifierFunc) Notify(ctx context.Context, notifications []feed.Notification) error {
+	return f(ctx, notifications)
+}
+
+func TestOutboxRelay(t *testing.T) {
+	db := feedtest.OpenPostgres(t)
+	feedtest.TruncatePostgres(t, db)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	now := time.Now()
+	var events []feed.Event
+	for n := byte(1); n <= 3; n++ {
+		events = append(events, feed.Event{
+			ID:          [16]byte{n},
+			URL:         fmt.Sprintf("https://polisen.se/aktuellt/handelser/%d", n),
+			Title:       "title",
+			Region:      "Händelser RSS - Blekinge",
+			Revision:    1,
+			CreateTime:  now,
+			PublishTime: now,
+			ContentHash: []byte{n},
+		})
+	}
+	require.NoError(t, feed.NewEventStorage(db).CreateEvents(ctx, events))
+
+	count := func(query string) int {
+		var n int
+		if err := db.QueryRow(query).Scan(&n); err != nil {
+			return -1
+		}
+		return n
+	}
+	type delivery struct {
+		notifications []feed.Notification
+		pending       int
+		openTxs       int
+	}
+	delivered := make(chan delivery, 1)
+	relay := feed.NewOutboxRelay(db, notifierFunc(
+		func(ctx context.Context, notifications []feed.Notification) error {
+			delivered <- delivery{
+				notifications: notifications,
+				pending: count(`select count(*) from event_outbox
+where deliver_time is null and next_attempt_time <= now()`),
+				openTxs: count(`select count(*) from pg_stat_activity
+where datname = current_database() and state like 'idle in transaction%'`),
+			}
+			return nil
+		},
+	))
+	done := make(chan error)
+	go func() { done <- relay.Run(ctx) }()
+
+	// The entries are claimed, and no transaction is held open while notifying
+	got := <-delivered
+	require.Len(t, got.notifications, len(events))
+	require.Zero(t, got.pending)
+	require.Zero(t, got.openTxs)
+	require.Eventually(t, func() bool {
+		return count("select count(*) from event_outbox where deliver_time is null") == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	require.NoError(t, <-done)
+}
@@ -0,0 +1,92 @@
+package feed
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"time"
+)
+
+// partitionPrefix is the name prefix of the monthly partitions of police_event,
+// followed by the year and month, e.g. police_event_p2022_06.
+const partitionPrefix = "police_event_p"
+
+// latestPartition returns the name of the most recent monthly partition.
+const latestPartition = `
+select coalesce(max(c.relname), '')
+from pg_inherits i
+join pg_class c on c.oid = i.inhrelid
+where i.inhparent = 'police_event'::regclass
+  and c.relname ~ '^` + partitionPrefix + `[0-9]{4}_[0-9]{2}$'`
+
+// partitionLockKey is the Postgres advisory lock key held while partitions are
+// created, so that replicas starting at the same time do not race to create
+// the same partitions.
+const partitionLockKey = 0x706172746974 // "partit"
+
+// EnsurePartitions creates the monthly partitions of police_event which are
+// missing after the latest existing partition, up to and including the month
+// monthsAhead months after now. It returns the names of the created partitions.
+// Concurrent calls, e.g. by replicas sharing the database, create the
+// partitions one at a time.
+//
+// Events whose publish month has no partition are stored in the default
+// partition, police_event_default. A partition cannot be created for a month
+// which has events in the default partition, so the partitions should be
+// created well ahead of time.
+func EnsurePartitions(
+	ctx context.Context, db *sql.DB, now time.Time, monthsAhead int,
+) (created []string, retErr error) {
+	// Partitions are created by one process at a time, each partition in its
+	// own statement so that the table is only locked briefly
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("open conn err, %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", partitionLockKey); err != nil {
+		return nil, fmt.Errorf("acquire partition lock err, %w", err)
+	}
+	defer func() {
+		_, err := conn.ExecContext(context.WithoutCancel(ctx),
+			"SELECT pg_advisory_unlock($1)", partitionLockKey)
+		if err != nil {
+			// Discard the connection, so that the lock is not kept by a
+			// session in the pool
+			conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+			if retErr == nil {
+				retErr = fmt.Errorf("release partition lock err, %w", err)
+			}
+		}
+	}()
+
+	var latest string
+	if err := conn.QueryRowContext(ctx, latestPartition).Scan(&latest); err != nil {
+		return nil, fmt.Errorf("get latest partition err, %w", err)
+	}
+	if latest == "" {
+		return nil, fmt.Errorf("no partitions named %v* found, is the schema migrated?", partitionPrefix)
+	}
+	month, err := time.Parse("2006_01", latest[len(partitionPrefix):])
+	if err != nil {
+		return nil, fmt.Errorf("parse partition name %v err, %w", latest, err)
+	}
+
+	now = now.UTC()
+	last := time.Date(now.Year(), now.Month()+time.Month(monthsAhead), 1, 0, 0, 0, 0, time.UTC)
+	for month = month.AddDate(0, 1, 0); !month.After(last); month = month.AddDate(0, 1, 0) {
+		// DDL does not accept parameters, the bounds are formatted by us
+		name := partitionPrefix + month.Format("2006_01")
+		_, err := conn.ExecContext(ctx, fmt.Sprintf(
+			`create table if not exists %v partition of police_event
+for values from ('%v') to ('%v')`,
+			name, month.Format(time.RFC3339), month.AddDate(0, 1, 0).Format(time.RFC3339),
+		))
+		if err != nil {
+			return created, fmt.Errorf("create partition %v err, %w", name, err)
+		}
+		created = append(created, name)
+	}
+	return created, nil
+}
@@ -0,0 +1,85 @@
+package feed_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sebnyberg/policefeed/feed"
+	"github.com/sebnyberg/policefeed/feed/feedtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnsurePartitions(t *testing.T) {
+	db := feedtest.OpenPostgres(t)
+	feedtest.TruncatePostgres(t, db)
+
+	ctx := context.Background()
+	now := time.Now()
+	_, err := feed.EnsurePartitions(ctx, db, now, 2)
+	require.NoError(t, err)
+	created, err := feed.EnsurePartitions(ctx, db, now, 2)
+	require.NoError(t, err)
+	require.Empty(t, created)
+
+	// Events can be stored in the partitions ahead of time, and revisions stay
+	// unique across partitions
+	publishTime := now.AddDate(0, 2, 0)
+	evt := feed.Event{
+		ID:          [16]byte{1},
+		URL:         "https://polisen.se/aktuellt/handelser/1",
+		Title:       "title",
+		Region:      "Händelser RSS - Blekinge",
+		Revision:    1,
+		CreateTime:  now,
+		PublishTime: publishTime,
+		ContentHash: []byte("a"),
+	}
+	s := feed.NewEventStorage(db)
+	require.NoError(t, s.CreateEvents(ctx, []feed.Event{evt}))
+	evt.PublishTime = now.AddDate(-1, 0, 0)
+	require.Error(t, s.CreateEvents(ctx, []feed.Event{evt}))
+
+	// Events of months without a partition are stored in the default partition
+	defaultEvt := evt
+	defaultEvt.ID = [16]byte{2}
+	defaultEvt.URL = "https://polisen.se/aktuellt/handelser/2"
+	defaultEvt.PublishTime = now.AddDate(1, 0, 0)
+	require.NoError(t, s.CreateEvents(ctx, []feed.Event{defaultEvt}))
+	var n int
+	require.NoError(t, db.QueryRow(`select count(*) from police_event_default`).Scan(&n))
+	require.Equal(t, 1, n)
+
+	got, err := s.ListUniqueEvents(ctx, []uuid.UUID{evt.ID})
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	require.WithinDuration(t, publishTime, got[0].PublishTime, time.Millisecond)
+}
+
+func TestEnsurePartitionsConcurrently(t *testing.T) {
+	db := feedtest.OpenPostgres(t)
+
+	ctx := context.Background()
+	now := time.Now()
+	type result struct {
+		created []string
+		err     error
+	}
+	results := make(chan result)
+	for i := 0; i < 3; i++ {
+		go func() {
+			created, err := feed.EnsurePartitions(ctx, db, now, 4)
+			results <- result{created: created, err: err}
+		}()
+	}
+	seen := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		res := <-results
+		require.NoError(t, res.err)
+		for _, name := range res.created {
+			require.False(t, seen[name], "partition %v created twice", name)
+			seen[name] = true
+		}
+	}
+}
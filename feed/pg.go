@@ -13,6 +13,7 @@ import (
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source"
 	"github.com/golang-migrate/migrate/v4/source/httpfs"
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/stdlib"
@@ -88,27 +89,80 @@ func (c *DBConfig) OpenDB() (*sql.DB, error) {
 //go:embed migrations
 var migrations embed.FS
 
-// version defines the current migration version. This ensures the app
-// is always compatible with the version of the database.
-const migrationVersion = 1
+// MigrationVersion defines the current migration version. This ensures the
+// app is always compatible with the version of the database.
+const MigrationVersion = 14
 
-// Migrate migrates the Postgres schema to the current version.
-func ValidateSchema(db *sql.DB) error {
+// NewMigrate returns a migrate instance for the Postgres schema using the
+// embedded migrations. Closing the instance also closes db.
+func NewMigrate(db *sql.DB) (*migrate.Migrate, error) {
+	m, _, err := newMigrate(db)
+	return m, err
+}
+
+func newMigrate(db *sql.DB) (*migrate.Migrate, source.Driver, error) {
 	sourceInstance, err := httpfs.New(http.FS(migrations), "migrations")
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 	targetInstance, err := postgres.WithInstance(db, new(postgres.Config))
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 	m, err := migrate.NewWithInstance("httpfs", sourceInstance, "postgres", targetInstance)
+	if err != nil {
+		return nil, nil, err
+	}
+	return m, sourceInstance, nil
+}
+
+// Migrate migrates the Postgres schema to the current version.
+func ValidateSchema(db *sql.DB) error {
+	m, sourceInstance, err := newMigrate(db)
 	if err != nil {
 		return err
 	}
-	err = m.Migrate(migrationVersion) // current version
+	err = m.Migrate(MigrationVersion) // current version
 	if err != nil && err != migrate.ErrNoChange {
 		return err
 	}
 	return sourceInstance.Close()
 }
+
+// ErrSchemaVersion is returned by CheckSchema when the schema version of the
+// database differs from MigrationVersion.
+var ErrSchemaVersion = errors.New("unexpected schema version")
+
+// CheckSchema checks that the Postgres schema is at the current version
+// without migrating it. The version is read from the schema_migrations table
+// directly, so that the check neither locks nor writes to the database.
+func CheckSchema(ctx context.Context, db *sql.DB) error {
+	var exists bool
+	err := db.QueryRowContext(ctx,
+		`select to_regclass('schema_migrations') is not null`).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	var version int64
+	var dirty bool
+	if exists {
+		err = db.QueryRowContext(ctx,
+			`select version, dirty from schema_migrations limit 1`).Scan(&version, &dirty)
+	}
+	if !exists || errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: no migrations applied, want version %v",
+			ErrSchemaVersion, MigrationVersion)
+	}
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("%w: version %v is dirty, fix the schema and force the version",
+			ErrSchemaVersion, version)
+	}
+	if version != MigrationVersion {
+		return fmt.Errorf("%w: got version %v, want version %v",
+			ErrSchemaVersion, version, MigrationVersion)
+	}
+	return nil
+}
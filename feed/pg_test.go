@@ -0,0 +1,24 @@
+package feed_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sebnyberg/policefeed/feed"
+	"github.com/sebnyberg/policefeed/feed/feedtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckSchema(t *testing.T) {
+	db := feedtest.OpenPostgres(t)
+
+	// The check holds no connection once done, so it can run more often than
+	// there are connections in the pool
+	for i := 0; i < 2*db.Stats().MaxOpenConnections; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		require.NoError(t, feed.CheckSchema(ctx, db))
+		cancel()
+	}
+	require.Zero(t, db.Stats().InUse)
+}
@@ -0,0 +1,38 @@
+package feed
+
+import (
+	"context"
+)
+
+// LatestEventLister lists the most recent revision of the most recently
+// published events.
+type LatestEventLister interface {
+	// ListLatestEvents lists at most limit events, ordered by publish time in
+	// descending order.
+	ListLatestEvents(ctx context.Context, limit int) ([]Event, error)
+}
+
+// SearchQuery is a full-text search query over event contents.
+type SearchQuery struct {
+	// Text is the query in web search syntax, e.g. `rån -väpnat "Malmö"`.
+	Text string
+	// Limit is the maximum number of results.
+	Limit int
+	// HighlightStart and HighlightStop surround matches in the snippet of
+	// each result. Defaults to "<b>" and "</b>".
+	HighlightStart string
+	HighlightStop  string
+}
+
+// SearchResult is an event matching a SearchQuery.
+type SearchResult struct {
+	Event
+	Rank    float32
+	Snippet string
+}
+
+// EventSearcher searches the most recent revision of events by their contents.
+type EventSearcher interface {
+	// SearchEvents returns events matching the query, ordered by rank.
+	SearchEvents(ctx context.Context, query SearchQuery) ([]SearchResult, error)
+}
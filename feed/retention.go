@@ -0,0 +1,107 @@
+package feed
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sebnyberg/policefeed/feed/feedpg"
+)
+
+// RetentionPolicy moves old event revisions out of the Postgres police_event
+// table.
+//
+// Once an event has not been seen in the RSS feed for the retention period,
+// only its first and last revisions are kept. The revisions in between are
+// moved to the police_event_archive table. Revisions created before the
+// retention period are archived by their create time if the event has never
+// been marked as seen. Revisions with pending outbox entries are kept until
+// they have been delivered.
+type RetentionPolicy struct {
+	queries   *feedpg.Queries
+	retention time.Duration
+	// batchSize is the maximum number of revisions archived per transaction.
+	batchSize int
+}
+
+func NewRetentionPolicy(db *sql.DB, retention time.Duration) *RetentionPolicy {
+	return &RetentionPolicy{
+		queries:   feedpg.New(db),
+		retention: retention,
+		batchSize: 1000,
+	}
+}
+
+// PruneStats counts the revisions of a region which are, or would be,
+// archived.
+type PruneStats struct {
+	Region    string
+	Events    int
+	Revisions int
+}
+
+// Plan returns the revisions which Prune would archive at the given time per
+// region, without archiving them.
+func (p *RetentionPolicy) Plan(ctx context.Context, now time.Time) ([]PruneStats, error) {
+	rows, err := p.queries.ListArchivableRevisions(ctx, now.Add(-p.retention))
+	if err != nil {
+		return nil, fmt.Errorf("list archivable revisions err, %w", err)
+	}
+	stats := make([]PruneStats, len(rows))
+	for i, row := range rows {
+		stats[i] = PruneStats{
+			Region:    row.Region,
+			Events:    int(row.Events),
+			Revisions: int(row.Revisions),
+		}
+	}
+	return stats, nil
+}
+
+// Prune archives the revisions which are older than the retention period at
+// the given time, and returns the archived revisions per region. Revisions are
+// archived in batches, so that a failure leaves the revisions of completed
+// batches archived.
+func (p *RetentionPolicy) Prune(ctx context.Context, now time.Time) ([]PruneStats, error) {
+	byRegion := make(map[string]*PruneStats)
+	events := make(map[uuid.UUID]struct{})
+	for {
+		rows, err := p.queries.ArchiveEventRevisions(ctx, feedpg.ArchiveEventRevisionsParams{
+			Before:  now.Add(-p.retention),
+			MaxRows: int32(p.batchSize),
+		})
+		if err != nil {
+			return sortedPruneStats(byRegion), fmt.Errorf("archive revisions err, %w", err)
+		}
+		for _, row := range rows {
+			stats, exists := byRegion[row.Region]
+			if !exists {
+				stats = &PruneStats{Region: row.Region}
+				byRegion[row.Region] = stats
+			}
+			stats.Revisions++
+			if _, exists := events[row.ID]; !exists {
+				events[row.ID] = struct{}{}
+				stats.Events++
+			}
+		}
+		archivedRevisions.Add(float64(len(rows)))
+		if len(rows) < p.batchSize {
+			return sortedPruneStats(byRegion), nil
+		}
+	}
+}
+
+func sortedPruneStats(byRegion map[string]*PruneStats) []PruneStats {
+	stats := make([]PruneStats, 0, len(byRegion))
+	for _, s := range byRegion {
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Region < stats[j].Region
+	})
+	return stats
+}
@@ -0,0 +1,86 @@
+package feed_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sebnyberg/policefeed/feed"
+	"github.com/sebnyberg/policefeed/feed/feedtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetentionPolicy(t *testing.T) {
+	db := feedtest.OpenPostgres(t)
+	feedtest.TruncatePostgres(t, db)
+
+	ctx := context.Background()
+	now := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	oldT := now.Add(-60 * 24 * time.Hour)
+	newEvent := func(n byte, revision int32, createTime time.Time) feed.Event {
+		return feed.Event{
+			ID:          [16]byte{n},
+			URL:         fmt.Sprintf("https://polisen.se/aktuellt/handelser/%d", n),
+			Title:       "title",
+			Region:      "Händelser RSS - Blekinge",
+			Revision:    revision,
+			CreateTime:  createTime,
+			PublishTime: oldT,
+			ContentHash: []byte{n, byte(revision)},
+		}
+	}
+	s := feed.NewEventStorage(db)
+	require.NoError(t, s.CreateEvents(ctx, []feed.Event{
+		// Event 1 has not been seen for long, revisions 2 and 3 are archived
+		newEvent(1, 1, oldT),
+		newEvent(1, 2, oldT),
+		newEvent(1, 3, oldT),
+		newEvent(1, 4, oldT),
+		// Event 2 is still in the feed and keeps all revisions
+		newEvent(2, 1, oldT),
+		newEvent(2, 2, oldT),
+		newEvent(2, 3, oldT),
+		// Event 3 keeps revision 2 until it has been notified about
+		newEvent(3, 1, oldT),
+		newEvent(3, 2, oldT),
+		newEvent(3, 3, oldT),
+	}))
+	_, err := db.Exec(`update event_outbox set deliver_time = now()
+where not (event_id = $1 and revision = 2)`, uuid.UUID{3})
+	require.NoError(t, err)
+	require.NoError(t, s.MarkEventsSeen(ctx, []uuid.UUID{{1}, {2}, {3}}, oldT))
+	require.NoError(t, s.MarkEventsSeen(ctx, []uuid.UUID{{2}}, now))
+
+	policy := feed.NewRetentionPolicy(db, 30*24*time.Hour)
+	want := []feed.PruneStats{{Region: "Händelser RSS - Blekinge", Events: 1, Revisions: 2}}
+	plan, err := policy.Plan(ctx, now)
+	require.NoError(t, err)
+	require.Equal(t, want, plan)
+
+	pruned, err := policy.Prune(ctx, now)
+	require.NoError(t, err)
+	require.Equal(t, want, pruned)
+
+	var archived []int32
+	rows, err := db.Query("select revision from police_event_archive order by revision")
+	require.NoError(t, err)
+	defer rows.Close()
+	for rows.Next() {
+		var rev int32
+		require.NoError(t, rows.Scan(&rev))
+		archived = append(archived, rev)
+	}
+	require.NoError(t, rows.Err())
+	require.Equal(t, []int32{2, 3}, archived)
+
+	got, err := s.ListUniqueEvents(ctx, []uuid.UUID{{1}})
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	require.Equal(t, int32(4), got[0].Revision)
+
+	plan, err = policy.Plan(ctx, now)
+	require.NoError(t, err)
+	require.Empty(t, plan)
+}
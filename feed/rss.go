@@ -7,9 +7,14 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -37,50 +42,102 @@ type RSSFeedItem struct {
 
 const rssBaseURL = "https://polisen.se/aktuellt/rss/%v/handelser-rss---%v/"
 
+// RegionErrors contains the errors of regions whose RSS feed could not be
+// fetched, by region ID.
+type RegionErrors map[string]error
+
+func (e RegionErrors) Error() string {
+	ids := keys(e)
+	sort.Strings(ids)
+	msgs := make([]string, len(ids))
+	for i, id := range ids {
+		msgs[i] = fmt.Sprintf("region %v: %v", id, e[id])
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// EventsFromRSS fetches events from the RSS feeds of the given regions. An
+// empty region ID fetches all regions.
+//
+// If the feeds of some regions could not be fetched, the events of the other
+// regions are returned together with RegionErrors.
 func EventsFromRSS(ctx context.Context, regionIDs []string) ([]Event, error) {
 	events := make(chan []Event)
 	if len(regionIDs) == 1 && regionIDs[0] == "" {
 		regionIDs = keys(rssRegions)
 	}
 
-	doRegion := func(regionCtx context.Context, regionID string) func() error {
-		return func() error {
-			// Validate region ID
-			if _, exists := rssRegions[regionID]; !exists {
-				return fmt.Errorf(
-					"unknown region %v, choose one or more of %v",
-					regionID, strings.Join(keys(rssRegions), ","),
-				)
-			}
-
-			// Create RSS URL
-			url := fmt.Sprintf(rssBaseURL, regionID, regionID)
-			if regionID == "jonkoping" {
-				url = fmt.Sprintf(rssBaseURL, "jonkopings-lan", "jonkoping")
-			}
+	// Validate region IDs
+	for _, regionID := range regionIDs {
+		if _, exists := rssRegions[regionID]; !exists {
+			ids := keys(rssRegions)
+			sort.Strings(ids)
+			return nil, fmt.Errorf(
+				"unknown region %v, choose one or more of %v (see the regions command)",
+				regionID, strings.Join(ids, ","),
+			)
+		}
+	}
 
+	logger := Logger(ctx)
+	var regionErrs RegionErrors
+	var regionErrsMtx sync.Mutex
+	doRegion := func(regionCtx context.Context, regionID string) func() error {
+		fetch := func(ctx context.Context) (int, error) {
 			// Make request
-			req, err := http.NewRequestWithContext(regionCtx, http.MethodGet, url, nil)
+			url := regionFeedURL(regionID)
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 			if err != nil {
-				return fmt.Errorf("create request, %w", err)
+				return 0, fmt.Errorf("create request, %w", err)
 			}
 			resp, err := http.DefaultClient.Do(req)
 			if err != nil {
-				return fmt.Errorf("send request, %w", err)
+				return 0, fmt.Errorf("send request, %w", err)
 			}
+			defer resp.Body.Close()
+			fetchResponses.WithLabelValues(regionID, strconv.Itoa(resp.StatusCode)).Inc()
+			trace.SpanFromContext(ctx).SetAttributes(
+				attribute.Int("http.status_code", resp.StatusCode))
 			if resp.StatusCode != 200 {
-				return fmt.Errorf("unexpected response code %v", resp.StatusCode)
+				return 0, fmt.Errorf("unexpected response code %v", resp.StatusCode)
 			}
 
 			// Parse response
 			parsedEvents, err := eventsFromRSSBody(resp.Body)
 			if err != nil {
-				return fmt.Errorf("parse events err, %w", err)
+				parseFailures.WithLabelValues(regionID).Inc()
+				return 0, fmt.Errorf("parse events err, %w", err)
 			}
 			select {
-			case <-regionCtx.Done():
+			case <-ctx.Done():
+				return 0, ctx.Err()
 			case events <- parsedEvents:
 			}
+			return len(parsedEvents), nil
+		}
+		return func() error {
+			ctx, span := tracer.Start(regionCtx, "fetch region",
+				trace.WithAttributes(attribute.String("region", regionID)))
+			start := time.Now()
+			n, err := fetch(ctx)
+			duration := time.Since(start)
+			span.SetAttributes(attribute.Int("events", n))
+			endSpan(span, err)
+			recordFetch(regionID, start, n, err)
+			fetchDuration.WithLabelValues(regionID).Observe(duration.Seconds())
+			if err != nil {
+				logger.Warn("Fetch region failed",
+					"region", regionID, "duration", duration, "error", err)
+				regionErrsMtx.Lock()
+				defer regionErrsMtx.Unlock()
+				if regionErrs == nil {
+					regionErrs = make(RegionErrors)
+				}
+				regionErrs[regionID] = err
+				return nil
+			}
+			logger.Debug("Fetched region",
+				"region", regionID, "events", n, "duration", duration)
 			return nil
 		}
 	}
@@ -108,6 +165,12 @@ func EventsFromRSS(ctx context.Context, regionIDs []string) ([]Event, error) {
 	close(events)
 	<-done
 
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if regionErrs != nil {
+		return result, regionErrs
+	}
 	return result, nil
 }
 
@@ -1,5 +1,10 @@
 package feed
 
+import (
+	"fmt"
+	"sort"
+)
+
 type rssRegion struct {
 	ID   string
 	Name string
@@ -31,9 +36,32 @@ var rssRegions = map[string]rssRegion{
 	"ostergotland":    {ID: "ostergotland", Name: "Östergötland"},
 }
 
-// func (r *Regions) GetRSSURL(regionID string) string {
-// 	if regionID == "jonkoping" {
-// 		return fmt.Sprintf(r.baseRSSURL, "jonkopings-lan", "jonkoping")
-// 	}
-// 	return fmt.Sprintf(r.baseRSSURL, regionID, regionID)
-// }
+// Region is a region with an RSS feed on the Swedish Police website.
+type Region struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	FeedURL string `json:"feedUrl"`
+}
+
+// Regions lists all supported regions ordered by ID.
+func Regions() []Region {
+	ids := keys(rssRegions)
+	sort.Strings(ids)
+	regions := make([]Region, len(ids))
+	for i, id := range ids {
+		regions[i] = Region{
+			ID:      id,
+			Name:    rssRegions[id].Name,
+			FeedURL: regionFeedURL(id),
+		}
+	}
+	return regions
+}
+
+// regionFeedURL returns the URL of the RSS feed of the region.
+func regionFeedURL(regionID string) string {
+	if regionID == "jonkoping" {
+		return fmt.Sprintf(rssBaseURL, "jonkopings-lan", "jonkoping")
+	}
+	return fmt.Sprintf(rssBaseURL, regionID, regionID)
+}
@@ -0,0 +1,24 @@
+package feed
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegions(t *testing.T) {
+	regions := Regions()
+	require.Len(t, regions, len(rssRegions))
+	for i, r := range regions {
+		if i > 0 {
+			require.Less(t, regions[i-1].ID, r.ID)
+		}
+		switch r.ID {
+		case "jonkoping":
+			require.Equal(t, "https://polisen.se/aktuellt/rss/jonkopings-lan/handelser-rss---jonkoping/", r.FeedURL)
+		case "blekinge":
+			require.Equal(t, "Blekinge", r.Name)
+			require.Equal(t, "https://polisen.se/aktuellt/rss/blekinge/handelser-rss---blekinge/", r.FeedURL)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package feed
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/sqlite"
+	"github.com/golang-migrate/migrate/v4/source/httpfs"
+	"github.com/google/uuid"
+)
+
+var _ EventListerCreator = new(SQLiteStorage)
+
+var _ LatestEventLister = new(SQLiteStorage)
+
+var _ ChangeLister = new(SQLiteStorage)
+
+var _ EventSeenMarker = new(SQLiteStorage)
+
+//go:embed sqlitemigrations
+var sqliteMigrations embed.FS
+
+// sqliteMigrationVersion defines the current SQLite migration version.
+const sqliteMigrationVersion = 4
+
+// SQLiteStorage stores events in a local SQLite database file. It is meant
+// for local runs that do not have access to a Postgres database.
+type SQLiteStorage struct {
+	db *sql.DB
+}
+
+// OpenSQLiteStorage opens the SQLite database at path, creating it if it does
+// not exist, and migrates its schema to the current version.
+func OpenSQLiteStorage(path string) (*SQLiteStorage, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite only supports a single writer
+	db.SetMaxOpenConns(1)
+
+	sourceInstance, err := httpfs.New(http.FS(sqliteMigrations), "sqlitemigrations")
+	if err != nil {
+		return nil, err
+	}
+	defer sourceInstance.Close()
+	targetInstance, err := sqlite.WithInstance(db, new(sqlite.Config))
+	if err != nil {
+		return nil, err
+	}
+	m, err := migrate.NewWithInstance("httpfs", sourceInstance, "sqlite", targetInstance)
+	if err != nil {
+		return nil, err
+	}
+	err = m.Migrate(sqliteMigrationVersion)
+	if err != nil && err != migrate.ErrNoChange {
+		return nil, fmt.Errorf("migrate sqlite schema err, %w", err)
+	}
+	return &SQLiteStorage{db: db}, nil
+}
+
+// Close closes the underlying database.
+func (s *SQLiteStorage) Close() error {
+	return s.db.Close()
+}
+
+const sqliteEventColumns = `id, url, title, region, description,
+  article_contents, publish_time, create_time, content_hash, revision, removed`
+
+// sqliteSelectEventColumns are the columns of events and the times they were
+// seen, see scanSQLiteEvent.
+const sqliteSelectEventColumns = `e.id, e.url, e.title, e.region, e.description,
+  e.article_contents, e.publish_time, e.create_time, e.content_hash, e.revision,
+  e.removed, s.first_seen_time, s.last_seen_time`
+
+// sqliteSelectEvents selects events together with the times they were seen.
+const sqliteSelectEvents = `select ` + sqliteSelectEventColumns + `
+from police_event e
+left join police_event_seen s on s.id = e.id`
+
+// ListUniqueEvents lists the most recent revision of each event. If ids is
+// non-empty, it is used to filter the result.
+func (s *SQLiteStorage) ListUniqueEvents(
+	ctx context.Context,
+	ids []uuid.UUID,
+) ([]Event, error) {
+	query := sqliteSelectEvents + `
+where not exists (
+  select 1 from police_event n where n.id = e.id and n.revision > e.revision
+)`
+	if len(ids) == 0 {
+		return s.queryEvents(ctx, query)
+	}
+
+	// Avoid hitting the max number of host parameters for large batches
+	const batchSize = 500
+	events := make([]Event, 0, len(ids))
+	for start := 0; start < len(ids); start += batchSize {
+		end := start + batchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		args := make([]interface{}, end-start)
+		for i, id := range ids[start:end] {
+			args[i] = id.String()
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(args)), ",")
+		batch, err := s.queryEvents(ctx, query+` and e.id in (`+placeholders+`)`, args...)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, batch...)
+	}
+	return events, nil
+}
+
+func (s *SQLiteStorage) ListLatestEvents(
+	ctx context.Context,
+	limit int,
+) ([]Event, error) {
+	return s.queryEvents(ctx, sqliteSelectEvents+`
+where not exists (
+  select 1 from police_event n where n.id = e.id and n.revision > e.revision
+)
+order by e.publish_time desc
+limit ?`, limit)
+}
+
+// ListEventChanges lists revisions ordered by their rowid. SQLite has a single
+// writer at a time, so rowids are assigned in the order revisions are
+// committed.
+func (s *SQLiteStorage) ListEventChanges(
+	ctx context.Context,
+	after ChangeCursor,
+	limit int,
+) ([]EventChange, error) {
+	filter := `(e.rowid, e.id, e.revision) > (?, ?, ?)`
+	args := []interface{}{after.Seq, after.ID.String(), after.Revision}
+	if since, ok := after.Since(); ok {
+		filter = `e.create_time > ?`
+		args = []interface{}{since.UnixNano()}
+	}
+	query := `select ` + sqliteSelectEventColumns + `, e.rowid
+from police_event e
+left join police_event_seen s on s.id = e.id
+where ` + filter + `
+order by e.rowid, e.id, e.revision
+limit ?`
+	args = append(args, limit)
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var changes []EventChange
+	for rows.Next() {
+		var change EventChange
+		if err := scanSQLiteEvent(rows, &change.Event, &change.Cursor.Seq); err != nil {
+			return nil, err
+		}
+		change.Cursor.ID = change.ID
+		change.Cursor.Revision = change.Revision
+		changes = append(changes, change)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+func (s *SQLiteStorage) queryEvents(
+	ctx context.Context,
+	query string,
+	args ...interface{},
+) ([]Event, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var events []Event
+	for rows.Next() {
+		var evt Event
+		if err := scanSQLiteEvent(rows, &evt); err != nil {
+			return nil, err
+		}
+		events = append(events, evt)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// scanSQLiteEvent scans an event selected by sqliteSelectEvents, followed by
+// any extra columns.
+func scanSQLiteEvent(rows *sql.Rows, evt *Event, extra ...interface{}) error {
+	var (
+		id          string
+		publishTime int64
+		createTime  int64
+		firstSeen   sql.NullInt64
+		lastSeen    sql.NullInt64
+	)
+	dest := append([]interface{}{
+		&id,
+		&evt.URL,
+		&evt.Title,
+		&evt.Region,
+		&evt.Description,
+		&evt.ArticleContents,
+		&publishTime,
+		&createTime,
+		&evt.ContentHash,
+		&evt.Revision,
+		&evt.Removed,
+		&firstSeen,
+		&lastSeen,
+	}, extra...)
+	if err := rows.Scan(dest...); err != nil {
+		return err
+	}
+	var err error
+	if evt.ID, err = uuid.Parse(id); err != nil {
+		return fmt.Errorf("parse event id, %w", err)
+	}
+	evt.PublishTime = time.Unix(0, publishTime)
+	evt.CreateTime = time.Unix(0, createTime)
+	if firstSeen.Valid {
+		evt.FirstSeenTime = time.Unix(0, firstSeen.Int64)
+		evt.LastSeenTime = time.Unix(0, lastSeen.Int64)
+	}
+	return nil
+}
+
+func (s *SQLiteStorage) CreateEvents(
+	ctx context.Context, events []Event,
+) (retErr error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx err, %w", err)
+	}
+	defer func() {
+		if retErr != nil {
+			tx.Rollback()
+		}
+	}()
+	stmt, err := tx.PrepareContext(ctx, `insert into police_event (`+
+		sqliteEventColumns+`) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("prepare insert err, %w", err)
+	}
+	defer stmt.Close()
+	for _, evt := range events {
+		if _, err := stmt.ExecContext(ctx,
+			evt.ID.String(),
+			evt.URL,
+			evt.Title,
+			evt.Region,
+			evt.Description,
+			evt.ArticleContents,
+			evt.PublishTime.UnixNano(),
+			evt.CreateTime.UnixNano(),
+			evt.ContentHash,
+			evt.Revision,
+			evt.Removed,
+		); err != nil {
+			return fmt.Errorf("insert event err, %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// MarkEventsSeen records that the events were seen in the RSS feed at
+// seenTime.
+func (s *SQLiteStorage) MarkEventsSeen(
+	ctx context.Context, ids []uuid.UUID, seenTime time.Time,
+) (retErr error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx err, %w", err)
+	}
+	defer func() {
+		if retErr != nil {
+			tx.Rollback()
+		}
+	}()
+	stmt, err := tx.PrepareContext(ctx, `insert into police_event_seen
+  (id, first_seen_time, last_seen_time) values (?, ?, ?)
+on conflict (id) do update
+set last_seen_time = max(last_seen_time, excluded.last_seen_time)`)
+	if err != nil {
+		return fmt.Errorf("prepare upsert err, %w", err)
+	}
+	defer stmt.Close()
+	for _, id := range ids {
+		if _, err := stmt.ExecContext(ctx,
+			id.String(), seenTime.UnixNano(), seenTime.UnixNano(),
+		); err != nil {
+			return fmt.Errorf("upsert seen time err, %w", err)
+		}
+	}
+	return tx.Commit()
+}
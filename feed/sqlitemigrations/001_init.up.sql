@@ -0,0 +1,18 @@
+create table if not exists police_event (
+  id text not null,
+  url text not null,
+  title text not null,
+  region text not null,
+  description text not null,
+  article_contents text not null default '',
+  -- times are stored as unix nanoseconds
+  publish_time integer not null,
+  create_time integer not null,
+  content_hash blob not null,
+  revision integer not null,
+  constraint police_event_pk
+    primary key (id, revision)
+);
+
+create index if not exists police_event_publish_time_idx
+  on police_event (publish_time);
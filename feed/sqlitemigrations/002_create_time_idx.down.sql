@@ -0,0 +1 @@
+drop index if exists police_event_create_time_idx;
@@ -0,0 +1,2 @@
+create index if not exists police_event_create_time_idx
+  on police_event (create_time, id, revision);
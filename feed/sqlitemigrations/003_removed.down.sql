@@ -0,0 +1 @@
+alter table police_event drop column removed;
@@ -0,0 +1 @@
+alter table police_event add column removed integer not null default 0;
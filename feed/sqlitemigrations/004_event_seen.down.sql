@@ -0,0 +1 @@
+drop table if exists police_event_seen;
@@ -0,0 +1,16 @@
+create table if not exists police_event_seen (
+  id text not null,
+  -- times are stored as unix nanoseconds
+  first_seen_time integer not null,
+  last_seen_time integer not null,
+  constraint police_event_seen_pk
+    primary key (id)
+);
+
+create index if not exists police_event_seen_last_seen_time_idx
+  on police_event_seen (last_seen_time);
+
+insert or ignore into police_event_seen (id, first_seen_time, last_seen_time)
+select id, min(create_time), max(create_time)
+from police_event
+group by id;
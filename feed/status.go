@@ -0,0 +1,67 @@
+package feed
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FeedStatus is the status of the RSS feed of a region, as seen by
+// EventsFromRSS in this process, or as stored by a FeedStatusStore.
+type FeedStatus struct {
+	RegionID string `json:"regionId"`
+	// LastAttempt is nil when the feed has not been fetched.
+	LastAttempt *time.Time `json:"lastAttempt"`
+	LastSuccess *time.Time `json:"lastSuccess"`
+	// ItemCount is the number of items in the last successfully fetched feed.
+	ItemCount int    `json:"itemCount"`
+	LastError string `json:"lastError,omitempty"`
+}
+
+var feedStatuses = struct {
+	mtx      sync.Mutex
+	byRegion map[string]FeedStatus
+}{byRegion: make(map[string]FeedStatus)}
+
+// recordFetch records the outcome of fetching the feed of a region.
+func recordFetch(regionID string, attemptTime time.Time, itemCount int, err error) {
+	feedStatuses.mtx.Lock()
+	defer feedStatuses.mtx.Unlock()
+	status := feedStatuses.byRegion[regionID]
+	status.RegionID = regionID
+	status.LastAttempt = &attemptTime
+	if err != nil {
+		status.LastError = err.Error()
+	} else {
+		status.LastSuccess = &attemptTime
+		status.ItemCount = itemCount
+		status.LastError = ""
+	}
+	feedStatuses.byRegion[regionID] = status
+}
+
+// FeedStatuses returns the status of the feeds of all regions that have been
+// fetched, ordered by region ID.
+func FeedStatuses() []FeedStatus {
+	feedStatuses.mtx.Lock()
+	defer feedStatuses.mtx.Unlock()
+	statuses := make([]FeedStatus, 0, len(feedStatuses.byRegion))
+	for _, status := range feedStatuses.byRegion {
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].RegionID < statuses[j].RegionID
+	})
+	return statuses
+}
+
+// FeedStatusStore stores feed statuses, so that processes sharing a storage
+// can report the status of feeds fetched by other processes.
+type FeedStatusStore interface {
+	// SaveFeedStatuses stores the statuses. A stored status is only replaced
+	// by a status with a later attempt.
+	SaveFeedStatuses(ctx context.Context, statuses []FeedStatus) error
+	// ListFeedStatuses lists the stored statuses, ordered by region ID.
+	ListFeedStatuses(ctx context.Context) ([]FeedStatus, error)
+}
@@ -0,0 +1,38 @@
+package feed
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeedStatuses(t *testing.T) {
+	t0 := time.Date(2022, 2, 9, 12, 0, 0, 0, time.UTC)
+	t1 := t0.Add(time.Minute)
+	recordFetch("skane", t0, 20, nil)
+	recordFetch("blekinge", t0, 0, errors.New("unexpected response code 503"))
+	recordFetch("skane", t1, 0, errors.New("unexpected response code 503"))
+
+	var got []FeedStatus
+	for _, status := range FeedStatuses() {
+		if status.RegionID == "skane" || status.RegionID == "blekinge" {
+			got = append(got, status)
+		}
+	}
+	require.Equal(t, []FeedStatus{
+		{
+			RegionID:    "blekinge",
+			LastAttempt: &t0,
+			LastError:   "unexpected response code 503",
+		},
+		{
+			RegionID:    "skane",
+			LastAttempt: &t1,
+			LastSuccess: &t0,
+			ItemCount:   20,
+			LastError:   "unexpected response code 503",
+		},
+	}, got)
+}
@@ -4,17 +4,31 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/stdlib"
 	"github.com/sebnyberg/policefeed/feed/feedpg"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var _ EventLister = new(EventStorage)
 
 var _ EventCreator = new(EventStorage)
 
+var _ LatestEventLister = new(EventStorage)
+
+var _ EventSearcher = new(EventStorage)
+
+var _ ChangeLister = new(EventStorage)
+
+var _ EventSeenMarker = new(EventStorage)
+
+var _ FeedStatusStore = new(EventStorage)
+
 type EventStorage struct {
 	db      *sql.DB
 	queries *feedpg.Queries
@@ -38,22 +52,233 @@ func (s *EventStorage) ListUniqueEvents(
 	events := make([]Event, len(dbEvents))
 	for i, dbEvent := range dbEvents {
 		events[i] = Event{
-			ID:          dbEvent.ID,
-			URL:         dbEvent.Url,
-			Title:       dbEvent.Title,
-			Region:      dbEvent.Region,
-			Description: dbEvent.Description,
-			Revision:    dbEvent.Revision,
-			PublishTime: dbEvent.PublishTime,
-			ContentHash: dbEvent.ContentHash,
+			ID:              dbEvent.ID,
+			URL:             dbEvent.Url,
+			Title:           dbEvent.Title,
+			Region:          dbEvent.Region,
+			Description:     dbEvent.Description,
+			ArticleContents: dbEvent.ArticleContents,
+			Revision:        dbEvent.Revision,
+			PublishTime:     dbEvent.PublishTime,
+			ContentHash:     dbEvent.ContentHash,
+			Removed:         dbEvent.Removed,
+			FirstSeenTime:   dbEvent.FirstSeenTime.Time,
+			LastSeenTime:    dbEvent.LastSeenTime.Time,
 		}
 	}
 	return events, nil
 }
 
+func (s *EventStorage) ListLatestEvents(
+	ctx context.Context,
+	limit int,
+) ([]Event, error) {
+	dbEvents, err := s.queries.ListLatestEvents(ctx, int32(limit))
+	if err != nil {
+		return nil, err
+	}
+	events := make([]Event, len(dbEvents))
+	for i, dbEvent := range dbEvents {
+		events[i] = Event{
+			ID:              dbEvent.ID,
+			URL:             dbEvent.Url,
+			Title:           dbEvent.Title,
+			Region:          dbEvent.Region,
+			Description:     dbEvent.Description,
+			ArticleContents: dbEvent.ArticleContents,
+			Revision:        dbEvent.Revision,
+			CreateTime:      dbEvent.CreateTime,
+			PublishTime:     dbEvent.PublishTime,
+			ContentHash:     dbEvent.ContentHash,
+			Removed:         dbEvent.Removed,
+			FirstSeenTime:   dbEvent.FirstSeenTime.Time,
+			LastSeenTime:    dbEvent.LastSeenTime.Time,
+		}
+	}
+	return events, nil
+}
+
+// ListEventChanges orders revisions by the ID of the transaction which created
+// them. Revisions of transactions which may still be running are not listed,
+// so a revision which commits late is never ordered before a listed one.
+func (s *EventStorage) ListEventChanges(
+	ctx context.Context,
+	after ChangeCursor,
+	limit int,
+) ([]EventChange, error) {
+	var dbEvents []feedpg.ListEventChangesRow
+	var err error
+	if since, ok := after.Since(); ok {
+		var rows []feedpg.ListEventChangesSinceRow
+		rows, err = s.queries.ListEventChangesSince(ctx, feedpg.ListEventChangesSinceParams{
+			Since:      since,
+			MaxResults: int32(limit),
+		})
+		for _, row := range rows {
+			dbEvents = append(dbEvents, feedpg.ListEventChangesRow(row))
+		}
+	} else {
+		dbEvents, err = s.queries.ListEventChanges(ctx, feedpg.ListEventChangesParams{
+			ChangeTxid: after.Seq,
+			ID:         after.ID,
+			Revision:   after.Revision,
+			MaxResults: int32(limit),
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	changes := make([]EventChange, len(dbEvents))
+	for i, dbEvent := range dbEvents {
+		changes[i] = EventChange{
+			Event: Event{
+				ID:              dbEvent.ID,
+				URL:             dbEvent.Url,
+				Title:           dbEvent.Title,
+				Region:          dbEvent.Region,
+				Description:     dbEvent.Description,
+				ArticleContents: dbEvent.ArticleContents,
+				Revision:        dbEvent.Revision,
+				CreateTime:      dbEvent.CreateTime,
+				PublishTime:     dbEvent.PublishTime,
+				ContentHash:     dbEvent.ContentHash,
+				Removed:         dbEvent.Removed,
+			},
+			Cursor: ChangeCursor{
+				Seq:      dbEvent.ChangeTxid,
+				ID:       dbEvent.ID,
+				Revision: dbEvent.Revision,
+			},
+		}
+	}
+	return changes, nil
+}
+
+func (s *EventStorage) SearchEvents(
+	ctx context.Context,
+	query SearchQuery,
+) ([]SearchResult, error) {
+	start, stop := query.HighlightStart, query.HighlightStop
+	if start == "" && stop == "" {
+		start, stop = "<b>", "</b>"
+	}
+	opts := fmt.Sprintf(
+		"StartSel=%v, StopSel=%v, MaxFragments=2, MinWords=5, MaxWords=20",
+		quoteHeadlineOption(start), quoteHeadlineOption(stop),
+	)
+	rows, err := s.queries.SearchEvents(ctx, feedpg.SearchEventsParams{
+		HeadlineOptions: opts,
+		Query:           query.Text,
+		MaxResults:      int32(query.Limit),
+	})
+	if err != nil {
+		return nil, err
+	}
+	results := make([]SearchResult, len(rows))
+	for i, row := range rows {
+		results[i] = SearchResult{
+			Event: Event{
+				ID:              row.ID,
+				URL:             row.Url,
+				Title:           row.Title,
+				Region:          row.Region,
+				Description:     row.Description,
+				ArticleContents: row.ArticleContents,
+				Revision:        row.Revision,
+				CreateTime:      row.CreateTime,
+				PublishTime:     row.PublishTime,
+				ContentHash:     row.ContentHash,
+				Removed:         row.Removed,
+				FirstSeenTime:   row.FirstSeenTime.Time,
+				LastSeenTime:    row.LastSeenTime.Time,
+			},
+			Rank:    row.Rank,
+			Snippet: row.Snippet,
+		}
+	}
+	return results, nil
+}
+
+// MarkEventsSeen records that the events were seen in the RSS feed at
+// seenTime, without creating new revisions.
+func (s *EventStorage) MarkEventsSeen(
+	ctx context.Context, ids []uuid.UUID, seenTime time.Time,
+) error {
+	return s.queries.MarkEventsSeen(ctx, feedpg.MarkEventsSeenParams{
+		SeenTime: seenTime,
+		Ids:      ids,
+	})
+}
+
+// SaveFeedStatuses stores the feed statuses, keeping stored statuses with a
+// later attempt.
+func (s *EventStorage) SaveFeedStatuses(
+	ctx context.Context, statuses []FeedStatus,
+) error {
+	for _, status := range statuses {
+		if status.LastAttempt == nil {
+			continue
+		}
+		var lastSuccess sql.NullTime
+		if status.LastSuccess != nil {
+			lastSuccess = sql.NullTime{Time: *status.LastSuccess, Valid: true}
+		}
+		err := s.queries.UpsertFeedStatus(ctx, feedpg.UpsertFeedStatusParams{
+			RegionID:    status.RegionID,
+			LastAttempt: *status.LastAttempt,
+			LastSuccess: lastSuccess,
+			ItemCount:   int32(status.ItemCount),
+			LastError:   status.LastError,
+		})
+		if err != nil {
+			return fmt.Errorf("save feed status of %v err, %w", status.RegionID, err)
+		}
+	}
+	return nil
+}
+
+// ListFeedStatuses lists the stored feed statuses, ordered by region ID.
+func (s *EventStorage) ListFeedStatuses(ctx context.Context) ([]FeedStatus, error) {
+	rows, err := s.queries.ListFeedStatuses(ctx)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]FeedStatus, len(rows))
+	for i, row := range rows {
+		lastAttempt := row.LastAttempt
+		statuses[i] = FeedStatus{
+			RegionID:    row.RegionID,
+			LastAttempt: &lastAttempt,
+			ItemCount:   int(row.ItemCount),
+			LastError:   row.LastError,
+		}
+		if row.LastSuccess.Valid {
+			lastSuccess := row.LastSuccess.Time
+			statuses[i].LastSuccess = &lastSuccess
+		}
+	}
+	return statuses, nil
+}
+
+// notifyEventsCreated sends one notification per created event revision on
+// the EventCreatedChannel.
+const notifyEventsCreated = `
+select pg_notify(
+  '` + EventCreatedChannel + `',
+  json_build_object('id', e.id, 'revision', e.revision, 'region', e.region)::text
+)
+from unnest($1::uuid[], $2::int[], $3::text[]) as e(id, revision, region)`
+
+// CreateEvents creates the provided events in a single transaction. For each
+// event, an outbox entry is added and a notification is sent on the
+// EventCreatedChannel.
 func (s *EventStorage) CreateEvents(
 	ctx context.Context, events []Event,
 ) (retErr error) {
+	ctx, span := tracer.Start(ctx, "EventStorage.CreateEvents",
+		trace.WithAttributes(attribute.Int("events", len(events))))
+	defer func() { endSpan(span, retErr) }()
+
 	conn, err := s.db.Conn(ctx)
 	if err != nil {
 		return fmt.Errorf("unexpected error opening conn, %w", err)
@@ -65,9 +290,25 @@ func (s *EventStorage) CreateEvents(
 		}
 	}()
 
-	return conn.Raw(func(driverConn interface{}) error {
+	return conn.Raw(func(driverConn interface{}) (retErr error) {
 		conn := driverConn.(*stdlib.Conn).Conn()
+		tx, err := conn.Begin(ctx)
+		if err != nil {
+			return fmt.Errorf("begin tx err, %w", err)
+		}
+		defer func() {
+			if retErr != nil {
+				tx.Rollback(ctx)
+			}
+		}()
+
+		if err := checkLeaseFence(ctx, tx); err != nil {
+			return err
+		}
+
 		rows := make([][]interface{}, len(events))
+		revisionRows := make([][]interface{}, len(events))
+		outboxRows := make([][]interface{}, len(events))
 		for i, evt := range events {
 			rows[i] = []interface{}{
 				evt.ID,
@@ -75,13 +316,37 @@ func (s *EventStorage) CreateEvents(
 				evt.Title,
 				evt.Region,
 				evt.Description,
+				evt.ArticleContents,
 				evt.PublishTime,
 				evt.CreateTime,
 				evt.ContentHash,
 				evt.Revision,
+				evt.Removed,
+			}
+			revisionRows[i] = []interface{}{
+				evt.ID,
+				evt.Revision,
+			}
+			outboxRows[i] = []interface{}{
+				evt.ID,
+				evt.Revision,
+				evt.IdempotencyKey(),
 			}
 		}
-		_, err = conn.CopyFrom(ctx,
+
+		// police_event is partitioned by publish time, revisions are kept
+		// unique by police_event_revision
+		_, err = tx.CopyFrom(ctx,
+			pgx.Identifier{"police_event_revision"},
+			[]string{"id", "revision"},
+			pgx.CopyFromRows(revisionRows),
+		)
+		if err != nil {
+			return err
+		}
+		copyCtx, copySpan := tracer.Start(ctx, "CopyFrom police_event")
+		copyStart := time.Now()
+		_, err = tx.CopyFrom(copyCtx,
 			pgx.Identifier{"police_event"},
 			[]string{
 				"id",
@@ -89,13 +354,57 @@ func (s *EventStorage) CreateEvents(
 				"title",
 				"region",
 				"description",
+				"article_contents",
 				"publish_time",
 				"create_time",
 				"content_hash",
 				"revision",
+				"removed",
 			},
 			pgx.CopyFromRows(rows),
 		)
-		return err
+		endSpan(copySpan, err)
+		if err != nil {
+			return err
+		}
+		copyTime := time.Since(copyStart)
+		copyDuration.Observe(copyTime.Seconds())
+		Logger(ctx).Debug("Copied events", "count", len(events), "duration", copyTime)
+
+		// Register notifications in the same transaction, see OutboxRelay
+		_, err = tx.CopyFrom(ctx,
+			pgx.Identifier{"event_outbox"},
+			[]string{
+				"event_id",
+				"revision",
+				"idempotency_key",
+			},
+			pgx.CopyFromRows(outboxRows),
+		)
+		if err != nil {
+			return err
+		}
+
+		// Notify listeners, delivered when the transaction commits
+		ids := make([]string, len(events))
+		revisions := make([]int32, len(events))
+		regions := make([]string, len(events))
+		for i, evt := range events {
+			ids[i] = evt.ID.String()
+			revisions[i] = evt.Revision
+			regions[i] = evt.Region
+		}
+		if _, err := tx.Exec(ctx, notifyEventsCreated, ids, revisions, regions); err != nil {
+			return fmt.Errorf("notify err, %w", err)
+		}
+		return tx.Commit(ctx)
 	})
 }
+
+// quoteHeadlineOption double-quotes a ts_headline option value so that it may
+// contain spaces, commas and escape sequences.
+func quoteHeadlineOption(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
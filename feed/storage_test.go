@@ -0,0 +1,228 @@
+package feed_test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sebnyberg/policefeed/feed"
+	"github.com/sebnyberg/policefeed/feed/feedtest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	feedtest.TestEventListerCreator(t, func(t *testing.T) feed.EventListerCreator {
+		return feed.NewMemoryStorage()
+	})
+}
+
+func TestSQLiteStorage(t *testing.T) {
+	feedtest.TestEventListerCreator(t, func(t *testing.T) feed.EventListerCreator {
+		s, err := feed.OpenSQLiteStorage(filepath.Join(t.TempDir(), "policefeed.db"))
+		require.NoError(t, err)
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
+
+func TestFileStorage(t *testing.T) {
+	feedtest.TestEventListerCreator(t, func(t *testing.T) feed.EventListerCreator {
+		s, err := feed.OpenFileStorage(t.TempDir())
+		require.NoError(t, err)
+		return s
+	})
+}
+
+// TestEventStorage runs against the test database given by
+// POLICEFEED_TEST_DATABASE, see feedtest.OpenPostgres. All data in the
+// database is removed.
+func TestEventStorage(t *testing.T) {
+	db := feedtest.OpenPostgres(t)
+
+	feedtest.TestEventListerCreator(t, func(t *testing.T) feed.EventListerCreator {
+		feedtest.TruncatePostgres(t, db)
+		return feed.NewEventStorage(db)
+	})
+}
+
+func TestEventStorageCurrent(t *testing.T) {
+	db := feedtest.OpenPostgres(t)
+	feedtest.TruncatePostgres(t, db)
+
+	ctx := context.Background()
+	publishTime := time.Date(2022, 2, 8, 17, 35, 0, 0, time.UTC)
+	newEvent := func(revision int32, title string) feed.Event {
+		return feed.Event{
+			ID:          [16]byte{1},
+			URL:         "https://polisen.se/aktuellt/handelser/1",
+			Title:       title,
+			Region:      "Händelser RSS - Blekinge",
+			Revision:    revision,
+			CreateTime:  publishTime,
+			PublishTime: publishTime,
+			ContentHash: []byte(title),
+		}
+	}
+	s := feed.NewEventStorage(db)
+
+	// An older revision created later does not replace the current revision
+	latest := newEvent(2, "08 februari 17:35, Trafikolycka, vilt, Karlskrona")
+	require.NoError(t, s.CreateEvents(ctx, []feed.Event{latest}))
+	require.NoError(t, s.CreateEvents(ctx, []feed.Event{
+		newEvent(1, "08 februari 17:35, Trafikolycka, Karlskrona"),
+	}))
+
+	got, err := s.ListUniqueEvents(ctx, []uuid.UUID{latest.ID})
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	require.Equal(t, latest.Revision, got[0].Revision)
+	require.Equal(t, latest.Title, got[0].Title)
+
+	var eventType string
+	err = db.QueryRow("select type from police_event_current where id = $1", latest.ID).
+		Scan(&eventType)
+	require.NoError(t, err)
+	require.Equal(t, latest.Type(), eventType)
+}
+
+func TestEventStorageSearch(t *testing.T) {
+	db := feedtest.OpenPostgres(t)
+	feedtest.TruncatePostgres(t, db)
+
+	ctx := context.Background()
+	publishTime := time.Date(2022, 2, 9, 10, 0, 0, 0, time.UTC)
+	newEvent := func(n byte, title, description, article string) feed.Event {
+		return feed.Event{
+			ID:              [16]byte{n},
+			URL:             fmt.Sprintf("https://polisen.se/aktuellt/handelser/%d", n),
+			Title:           title,
+			Region:          "Händelser RSS - Skåne",
+			Description:     description,
+			ArticleContents: article,
+			Revision:        1,
+			CreateTime:      publishTime,
+			PublishTime:     publishTime.Add(time.Duration(n) * time.Minute),
+			ContentHash:     []byte{n},
+		}
+	}
+	s := feed.NewEventStorage(db)
+	require.NoError(t, s.CreateEvents(ctx, []feed.Event{
+		newEvent(1, "09 februari 10:01, Rån, Malmö",
+			"En butik i centrala Malmö rånades.", ""),
+		newEvent(2, "09 februari 10:02, Inbrott, Malmö",
+			"Inbrott i en villa.", "Grannen misstänker att rånet mot butiken hänger ihop."),
+		newEvent(3, "09 februari 10:03, Rån väpnat, Lund",
+			"Väpnat rån mot en bensinstation.", ""),
+		newEvent(4, "09 februari 10:04, Trafikolycka, Lund",
+			"Två bilar krockade.", ""),
+	}))
+	search := func(text string) []feed.SearchResult {
+		t.Helper()
+		res, err := s.SearchEvents(ctx, feed.SearchQuery{
+			Text:           text,
+			Limit:          10,
+			HighlightStart: "[",
+			HighlightStop:  "]",
+		})
+		require.NoError(t, err)
+		return res
+	}
+	ids := func(results []feed.SearchResult) []byte {
+		res := make([]byte, len(results))
+		for i, r := range results {
+			res[i] = r.ID[0]
+		}
+		return res
+	}
+
+	// Inflections match through Swedish stemming, and matches in the title
+	// rank above matches in the article
+	got := search("rånet")
+	require.Equal(t, []byte{3, 1, 2}, ids(got))
+	require.Greater(t, got[1].Rank, got[2].Rank)
+	require.Contains(t, got[1].Snippet, "[Rån]")
+
+	// Web search syntax excludes words and requires phrases
+	require.Equal(t, []byte{1, 2}, ids(search("rån -väpnat")))
+	require.Equal(t, []byte{3}, ids(search(`"väpnat rån"`)))
+	require.Empty(t, search("misshandel"))
+}
+
+func TestEventStorageFeedStatuses(t *testing.T) {
+	db := feedtest.OpenPostgres(t)
+	feedtest.TruncatePostgres(t, db)
+
+	ctx := context.Background()
+	t0 := time.Date(2022, 2, 9, 12, 0, 0, 0, time.UTC)
+	t1 := t0.Add(time.Minute)
+	s := feed.NewEventStorage(db)
+	require.NoError(t, s.SaveFeedStatuses(ctx, []feed.FeedStatus{
+		{RegionID: "skane", LastAttempt: &t0, LastSuccess: &t0, ItemCount: 20},
+		{RegionID: "blekinge", LastAttempt: &t1, LastError: "unexpected response code 503"},
+	}))
+	// A failed fetch keeps the last success, and an earlier attempt, e.g. by
+	// a replica which lost its lease, is ignored
+	require.NoError(t, s.SaveFeedStatuses(ctx, []feed.FeedStatus{
+		{RegionID: "skane", LastAttempt: &t1, LastError: "unexpected response code 503"},
+		{RegionID: "blekinge", LastAttempt: &t0, LastSuccess: &t0, ItemCount: 5},
+	}))
+
+	got, err := s.ListFeedStatuses(ctx)
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	require.Equal(t, "blekinge", got[0].RegionID)
+	require.True(t, t1.Equal(*got[0].LastAttempt))
+	require.Nil(t, got[0].LastSuccess)
+	require.Equal(t, "skane", got[1].RegionID)
+	require.True(t, t1.Equal(*got[1].LastAttempt))
+	require.True(t, t0.Equal(*got[1].LastSuccess))
+	require.Equal(t, 20, got[1].ItemCount)
+	require.Equal(t, "unexpected response code 503", got[1].LastError)
+}
+
+func TestEventStorageChangesCommitOrder(t *testing.T) {
+	db := feedtest.OpenPostgres(t)
+	feedtest.TruncatePostgres(t, db)
+
+	ctx := context.Background()
+	t0 := time.Date(2022, 2, 9, 12, 0, 0, 0, time.UTC)
+	s := feed.NewEventStorage(db)
+
+	// A revision is created in a transaction which commits after a revision
+	// of a later transaction
+	tx, err := db.BeginTx(ctx, nil)
+	require.NoError(t, err)
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, `insert into police_event_revision (id, revision)
+values ($1, 1)`, uuid.UUID{1})
+	require.NoError(t, err)
+	_, err = tx.ExecContext(ctx, `insert into police_event (id, url, title, region,
+  description, publish_time, create_time, content_hash, revision)
+values ($1, '', 'late', 'Händelser RSS - Blekinge', '', $2, $2, '', 1)`, uuid.UUID{1}, t0)
+	require.NoError(t, err)
+	require.NoError(t, s.CreateEvents(ctx, []feed.Event{{
+		ID:          uuid.UUID{2},
+		Title:       "early",
+		Region:      "Händelser RSS - Blekinge",
+		Revision:    1,
+		CreateTime:  t0.Add(time.Minute),
+		PublishTime: t0.Add(time.Minute),
+		ContentHash: []byte("early"),
+	}}))
+
+	// Revisions of the later transaction are not listed while the earlier
+	// transaction is running
+	got, err := s.ListEventChanges(ctx, feed.ChangeCursor{}, 10)
+	require.NoError(t, err)
+	require.Empty(t, got)
+
+	require.NoError(t, tx.Commit())
+	got, err = s.ListEventChanges(ctx, feed.ChangeCursor{}, 10)
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	require.Equal(t, "late", got[0].Title)
+	require.Equal(t, "early", got[1].Title)
+}
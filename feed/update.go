@@ -5,11 +5,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
 	"sort"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // EventLister lists events using an optional filter.
@@ -19,6 +20,8 @@ type EventLister interface {
 	ListUniqueEvents(ctx context.Context, ids []uuid.UUID) ([]Event, error)
 }
 
+var _ RegionReader = new(RSSAdapter)
+
 // RSSAdapter makes it possible to use the RSS Events functions as an
 // EventLister.
 type RSSAdapter struct {
@@ -40,13 +43,25 @@ func NewRSSAdapter(
 	}
 }
 
-// ListUniqueEvents lists events found in the RSS feeds for the given regions
+// RegionIDs returns the IDs of the regions read by the adapter.
+func (a *RSSAdapter) RegionIDs() []string {
+	if len(a.regionIDs) == 1 && a.regionIDs[0] == "" {
+		return keys(rssRegions)
+	}
+	return a.regionIDs
+}
+
+// ListUniqueEvents lists events found in the RSS feeds for the given regions.
+//
+// If some regions could not be read, the events of the other regions are
+// returned together with RegionErrors.
 func (a *RSSAdapter) ListUniqueEvents(ctx context.Context, ids []uuid.UUID) ([]Event, error) {
 	if len(ids) != 0 {
 		return nil, errors.New("RSS feed cannot filter by ID")
 	}
 	events, err := a.read(ctx, a.regionIDs)
-	if err != nil {
+	var regionErrs RegionErrors
+	if err != nil && !errors.As(err, &regionErrs) {
 		return nil, err
 	}
 
@@ -67,6 +82,9 @@ func (a *RSSAdapter) ListUniqueEvents(ctx context.Context, ids []uuid.UUID) ([]E
 	}
 	events = events[:j]
 
+	if regionErrs != nil {
+		return events, regionErrs
+	}
 	return events, nil
 }
 
@@ -76,6 +94,21 @@ type EventCreator interface {
 	CreateEvents(context.Context, []Event) error
 }
 
+// EventSeenMarker records when events were last seen in the RSS feed.
+type EventSeenMarker interface {
+	// MarkEventsSeen records that the events were seen at seenTime. The
+	// first time an event is marked is kept as its first seen time.
+	MarkEventsSeen(ctx context.Context, ids []uuid.UUID, seenTime time.Time) error
+}
+
+// RegionReader is implemented by event sources which read a known set of
+// regions, such as RSSAdapter. Update records the last successful update of
+// each region of a RegionReader.
+type RegionReader interface {
+	// RegionIDs returns the IDs of the regions read by the source.
+	RegionIDs() []string
+}
+
 // EventListerCreator supprots both creating and listing events. This is
 // required by the target of the Update functionality.
 type EventListerCreator interface {
@@ -83,10 +116,23 @@ type EventListerCreator interface {
 	EventLister
 }
 
+// removalMisses is the number of consecutive fetches that an event must be
+// missing from, while both newer and older events of its region are present,
+// before it is considered removed from the feed.
+const removalMisses = 2
+
 type Updater struct {
 	toCreate     map[uuid.UUID]Event
 	toCreateList []Event
 	ids          []uuid.UUID
+	// seen contains the events of previous fetches which are still within
+	// the time window of their region's feed.
+	seen map[uuid.UUID]Event
+	// misses contains the number of consecutive fetches that seen events
+	// have been missing from.
+	misses map[uuid.UUID]int
+	// prevSeenTime is the time of the previous fetch.
+	prevSeenTime time.Time
 	mtx          sync.Mutex
 }
 
@@ -95,16 +141,51 @@ func NewUpdater() *Updater {
 		toCreate:     make(map[uuid.UUID]Event, 1000),
 		toCreateList: make([]Event, 1000),
 		ids:          make([]uuid.UUID, 1000),
+		seen:         make(map[uuid.UUID]Event, 1000),
+		misses:       make(map[uuid.UUID]int),
 	}
 }
 
-// Update updates the provided database with records from the Police RSS feed
-// on an interval given by refreshTime.
+// UpdateResult summarizes the outcome of an update.
+type UpdateResult struct {
+	// Created is the number of events that did not exist in the target.
+	Created int
+	// Revised is the number of events that were stored as a new revision.
+	Revised int
+	// Unchanged is the number of events that already existed in the target.
+	Unchanged int
+	// Removed is the number of events that were stored as a tombstone
+	// revision because they were removed from the feed.
+	Removed int
+	// FailedRegions contains the regions that could not be read, if any.
+	FailedRegions RegionErrors
+}
+
+// Update updates the provided database with records from the Police RSS feed.
+//
+// Regions that could not be read are reported in the result rather than as
+// an error, so that the events of the other regions are still stored.
+//
+// Events which were seen by previous updates but have since been removed from
+// the feed are stored as a tombstone revision, see Event.Removed. Detection
+// requires the same Updater to be used across updates of a region, since the
+// events seen by previous updates are only kept in memory. A new Updater,
+// e.g. after a restart or for a single run of sync, detects no removals
+// until it has fetched the feed removalMisses+1 times. If the
+// target is an EventSeenMarker, the fetched events are marked as seen, and
+// events which have been seen since the previous fetch, e.g. by another
+// process, are not considered removed.
 func (u *Updater) Update(
 	ctx context.Context,
 	rss EventLister,
 	target EventListerCreator,
-) error {
+) (res UpdateResult, err error) {
+	ctx, span := tracer.Start(ctx, "Updater.Update")
+	defer func() { endSpan(span, err) }()
+	start := time.Now()
+	logger := Logger(ctx).With("cycle_id", uuid.NewString())
+	ctx = WithLogger(ctx, logger)
+
 	u.mtx.Lock()
 	defer u.mtx.Unlock()
 	// Cleanup
@@ -115,49 +196,174 @@ func (u *Updater) Update(
 	}
 
 	// Fetch RSS events
-	rssEvents, err := rss.ListUniqueEvents(ctx, nil)
-	if err != nil {
-		return fmt.Errorf("update events err, %w", err)
+	listCtx, listSpan := tracer.Start(ctx, "list source events")
+	rssEvents, err := rss.ListUniqueEvents(listCtx, nil)
+	if err != nil && !errors.As(err, &res.FailedRegions) {
+		endSpan(listSpan, err)
+		return res, fmt.Errorf("update events err, %w", err)
 	}
+	listSpan.SetAttributes(attribute.Int("events", len(rssEvents)))
+	endSpan(listSpan, err)
+	seenTime := time.Now()
 
-	// Gather ids for Events
+	// Gather ids for Events, including events that have been removed
 	for _, evt := range rssEvents {
 		u.ids = append(u.ids, evt.ID)
 	}
+	removedIDs, seen, misses := u.findRemoved(rssEvents)
+	u.ids = append(u.ids, removedIDs...)
 
 	// Fetch existing events
-	targetEvents, err := target.ListUniqueEvents(ctx, u.ids)
+	listCtx, listSpan = tracer.Start(ctx, "list existing events")
+	targetEvents, err := target.ListUniqueEvents(listCtx, u.ids)
+	endSpan(listSpan, err)
 	if err != nil {
-		return fmt.Errorf("fetch existing events err, %w", err)
+		return res, fmt.Errorf("fetch existing events err, %w", err)
 	}
 
 	// Add existing events to map
+	_, diffSpan := tracer.Start(ctx, "diff events")
 	for _, evt := range targetEvents {
 		u.toCreate[evt.ID] = evt
 	}
 	for _, rssEvent := range rssEvents {
 		if cur, exists := u.toCreate[rssEvent.ID]; exists {
-			if bytes.Equal(cur.ContentHash, rssEvent.ContentHash) ||
-				cur.PublishTime.After(rssEvent.PublishTime) {
+			// Events which reappear after being removed are always revised
+			if !cur.Removed && (bytes.Equal(cur.ContentHash, rssEvent.ContentHash) ||
+				cur.PublishTime.After(rssEvent.PublishTime)) {
 				delete(u.toCreate, rssEvent.ID) // should not update
+				res.Unchanged++
 				continue
 			}
 			rssEvent.Revision = cur.Revision + 1
 			u.toCreate[rssEvent.ID] = rssEvent
+			res.Revised++
 		} else { // Create new event
 			rssEvent.Revision = 1
 			u.toCreate[rssEvent.ID] = rssEvent
+			res.Created++
 		}
 	}
+	for _, id := range removedIDs {
+		cur, exists := u.toCreate[id]
+		if !exists { // never stored
+			continue
+		}
+		if cur.Removed || !cur.LastSeenTime.Before(u.prevSeenTime) {
+			delete(u.toCreate, id)
+			continue
+		}
+		cur.Revision++
+		cur.Removed = true
+		cur.CreateTime = seenTime
+		u.toCreate[id] = cur
+		res.Removed++
+	}
+	diffSpan.SetAttributes(
+		attribute.Int("created", res.Created),
+		attribute.Int("revised", res.Revised),
+		attribute.Int("unchanged", res.Unchanged),
+		attribute.Int("removed", res.Removed),
+	)
+	diffSpan.End()
 
 	// Create events
-	log.Printf("Creating %d records...\n", len(u.toCreate))
 	for _, evt := range u.toCreate {
+		logger.Debug("Creating event",
+			"event_id", evt.ID, "revision", evt.Revision, "region", evt.Region)
 		u.toCreateList = append(u.toCreateList, evt)
 	}
 	if err := target.CreateEvents(ctx, u.toCreateList); err != nil {
-		return fmt.Errorf("failed to create new events, %w", err)
+		return res, fmt.Errorf("failed to create new events, %w", err)
+	}
+	// Only count the misses of fetches whose events were stored
+	for _, id := range removedIDs {
+		delete(seen, id)
+		delete(misses, id)
+	}
+	u.seen, u.misses = seen, misses
+
+	// Record that the fetched events are still in the feed
+	if marker, ok := target.(EventSeenMarker); ok && len(rssEvents) > 0 {
+		if err := marker.MarkEventsSeen(ctx, u.ids[:len(rssEvents)], seenTime); err != nil {
+			return res, fmt.Errorf("mark events seen err, %w", err)
+		}
+	}
+	u.prevSeenTime = seenTime
+
+	logger.Info("Updated events",
+		"created", res.Created,
+		"revised", res.Revised,
+		"unchanged", res.Unchanged,
+		"removed", res.Removed,
+		"failed_regions", len(res.FailedRegions),
+		"duration", time.Since(start),
+	)
+	eventsCreated.Add(float64(res.Created))
+	eventsRevised.Add(float64(res.Revised))
+	eventsRemoved.Add(float64(res.Removed))
+	if r, ok := rss.(RegionReader); ok {
+		for _, regionID := range r.RegionIDs() {
+			if _, failed := res.FailedRegions[regionID]; !failed {
+				lastUpdateTime.WithLabelValues(regionID).SetToCurrentTime()
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// findRemoved returns the IDs of previously seen events which have now been
+// missing from removalMisses consecutive fetches, even though both newer and
+// older events of their region were present. It also returns the seen events
+// and misses including the fetched events, which replace u.seen and u.misses
+// once the events have been stored.
+//
+// Events that are older than all fetched events of their region have aged out
+// of the feed and are forgotten. Events of regions without fetched events,
+// e.g. because the region could not be read, are left as is.
+func (u *Updater) findRemoved(events []Event) (
+	removed []uuid.UUID, seen map[uuid.UUID]Event, misses map[uuid.UUID]int,
+) {
+	type window struct{ oldest, newest time.Time }
+	windows := make(map[string]window)
+	fetched := make(map[uuid.UUID]bool, len(events))
+	for _, evt := range events {
+		fetched[evt.ID] = true
+		w, exists := windows[evt.Region]
+		if !exists || evt.PublishTime.Before(w.oldest) {
+			w.oldest = evt.PublishTime
+		}
+		if !exists || evt.PublishTime.After(w.newest) {
+			w.newest = evt.PublishTime
+		}
+		windows[evt.Region] = w
 	}
 
-	return nil
+	seen = make(map[uuid.UUID]Event, len(u.seen)+len(events))
+	misses = make(map[uuid.UUID]int, len(u.misses))
+	for id, evt := range u.seen {
+		if fetched[id] {
+			continue
+		}
+		w, exists := windows[evt.Region]
+		if exists && !evt.PublishTime.After(w.oldest) {
+			continue
+		}
+		seen[id] = evt
+		if !exists || !evt.PublishTime.Before(w.newest) {
+			if n := u.misses[id]; n > 0 {
+				misses[id] = n
+			}
+			continue
+		}
+		misses[id] = u.misses[id] + 1
+		if misses[id] >= removalMisses {
+			removed = append(removed, id)
+		}
+	}
+	for _, evt := range events {
+		seen[evt.ID] = evt
+	}
+	return removed, seen, misses
 }
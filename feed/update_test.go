@@ -2,10 +2,12 @@ package feed_test
 
 import (
 	"context"
+	"errors"
 	"sort"
 	"testing"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/sebnyberg/policefeed/feed"
 	"github.com/sebnyberg/policefeed/feed/feedfakes"
 	"github.com/stretchr/testify/require"
@@ -88,7 +90,7 @@ func TestUpdate(t *testing.T) {
 			target.ListUniqueEventsReturns(cast(tc.oldEvents, asEvent), tc.targetListErr)
 			target.CreateEventsReturns(tc.targetCreateErr)
 			up := feed.NewUpdater()
-			gotErr := up.Update(context.Background(), source, target)
+			_, gotErr := up.Update(context.Background(), source, target)
 
 			// Assert
 			if tc.wantErr != nil {
@@ -113,3 +115,121 @@ func TestUpdate(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdatePartialFailure(t *testing.T) {
+	regionErr := errors.New("unexpected response code 503")
+	source := feed.NewRSSAdapter([]string{},
+		func(ctx context.Context, regionIDs []string) ([]feed.Event, error) {
+			return []feed.Event{{ID: [16]byte{1}, ContentHash: []byte("a")}},
+				feed.RegionErrors{"skane": regionErr}
+		},
+	)
+	target := new(feedfakes.FakeEventListerCreator)
+	up := feed.NewUpdater()
+	res, err := up.Update(context.Background(), source, target)
+	require.NoError(t, err)
+	require.Equal(t, 1, res.Created)
+	require.Equal(t, feed.RegionErrors{"skane": regionErr}, res.FailedRegions)
+	require.Equal(t, 1, target.CreateEventsCallCount())
+}
+
+// newFeedEvent returns the nth event of a region's feed, published n minutes
+// after the first.
+func newFeedEvent(n byte) feed.Event {
+	return feed.Event{
+		ID:          [16]byte{n},
+		Region:      "Händelser RSS - Blekinge",
+		PublishTime: time.Date(2022, 2, 9, 12, int(n), 0, 0, time.UTC),
+		ContentHash: []byte{n},
+	}
+}
+
+// newFeedSource returns a source which lists the events currently in events.
+func newFeedSource(events *[]feed.Event) *feed.RSSAdapter {
+	return feed.NewRSSAdapter([]string{},
+		func(ctx context.Context, regionIDs []string) ([]feed.Event, error) {
+			return append([]feed.Event(nil), *events...), nil
+		},
+	)
+}
+
+func TestUpdateAgedOutEvents(t *testing.T) {
+	rssEvents := []feed.Event{newFeedEvent(1), newFeedEvent(2), newFeedEvent(3)}
+	source := newFeedSource(&rssEvents)
+	target := feed.NewMemoryStorage()
+	up := feed.NewUpdater()
+	_, err := up.Update(context.Background(), source, target)
+	require.NoError(t, err)
+
+	// The oldest event drops out of the feed as a new one is published
+	rssEvents = []feed.Event{newFeedEvent(2), newFeedEvent(3), newFeedEvent(4)}
+	for i := 0; i < 3; i++ {
+		res, err := up.Update(context.Background(), source, target)
+		require.NoError(t, err)
+		require.Zero(t, res.Removed)
+	}
+}
+
+func TestUpdateRemovedEventSeenElsewhere(t *testing.T) {
+	rssEvents := []feed.Event{newFeedEvent(1), newFeedEvent(2), newFeedEvent(3)}
+	source := newFeedSource(&rssEvents)
+	target := feed.NewMemoryStorage()
+	up := feed.NewUpdater()
+	_, err := up.Update(context.Background(), source, target)
+	require.NoError(t, err)
+
+	rssEvents = []feed.Event{newFeedEvent(1), newFeedEvent(3)}
+	_, err = up.Update(context.Background(), source, target)
+	require.NoError(t, err)
+
+	// Another process still sees the event
+	require.NoError(t, target.MarkEventsSeen(context.Background(),
+		[]uuid.UUID{newFeedEvent(2).ID}, time.Now()))
+	res, err := up.Update(context.Background(), source, target)
+	require.NoError(t, err)
+	require.Zero(t, res.Removed)
+
+	got, err := target.ListUniqueEvents(context.Background(), []uuid.UUID{newFeedEvent(2).ID})
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	require.False(t, got[0].Removed)
+	require.True(t, got[0].LastSeenTime.After(got[0].FirstSeenTime))
+}
+
+// failingStorage fails to create events while err is set.
+type failingStorage struct {
+	*feed.MemoryStorage
+	err error
+}
+
+func (s *failingStorage) CreateEvents(ctx context.Context, events []feed.Event) error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.MemoryStorage.CreateEvents(ctx, events)
+}
+
+func TestUpdateRemovedEventFailedCycles(t *testing.T) {
+	rssEvents := []feed.Event{newFeedEvent(1), newFeedEvent(2), newFeedEvent(3)}
+	source := newFeedSource(&rssEvents)
+	target := &failingStorage{MemoryStorage: feed.NewMemoryStorage()}
+	up := feed.NewUpdater()
+	_, err := up.Update(context.Background(), source, target)
+	require.NoError(t, err)
+
+	// Misses of cycles which failed to store the events are not counted
+	rssEvents = []feed.Event{newFeedEvent(1), newFeedEvent(3)}
+	target.err = errors.New("disk full")
+	for i := 0; i < 2; i++ {
+		_, err := up.Update(context.Background(), source, target)
+		require.Error(t, err)
+	}
+	target.err = nil
+	res, err := up.Update(context.Background(), source, target)
+	require.NoError(t, err)
+	require.Zero(t, res.Removed)
+
+	res, err = up.Update(context.Background(), source, target)
+	require.NoError(t, err)
+	require.Equal(t, 1, res.Removed)
+}
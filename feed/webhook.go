@@ -0,0 +1,89 @@
+package feed
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+var _ EventCreator = new(Webhook)
+
+var _ Notifier = new(Webhook)
+
+// Webhook posts created events as JSON to a URL. It can be used as the sink of
+// a Mirror, or as a Notifier.
+type Webhook struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhook(url string) *Webhook {
+	return &Webhook{
+		url:    url,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+type webhookPayload struct {
+	Events []PublicEvent `json:"events"`
+}
+
+// CreateEvents posts the events to the webhook URL. Any response code other
+// than 2xx is considered an error.
+func (w *Webhook) CreateEvents(ctx context.Context, events []Event) error {
+	payload := webhookPayload{Events: make([]PublicEvent, len(events))}
+	for i, evt := range events {
+		payload.Events[i] = evt.Public()
+	}
+	return w.post(ctx, payload)
+}
+
+type webhookNotification struct {
+	IdempotencyKey string      `json:"idempotencyKey"`
+	Event          PublicEvent `json:"event"`
+}
+
+type webhookNotificationPayload struct {
+	Notifications []webhookNotification `json:"notifications"`
+}
+
+// Notify posts the notifications to the webhook URL. Each notification carries
+// an idempotency key that the receiver may use to discard duplicates.
+func (w *Webhook) Notify(ctx context.Context, notifications []Notification) error {
+	payload := webhookNotificationPayload{
+		Notifications: make([]webhookNotification, len(notifications)),
+	}
+	for i, n := range notifications {
+		payload.Notifications[i] = webhookNotification{
+			IdempotencyKey: n.IdempotencyKey,
+			Event:          n.Event.Public(),
+		}
+	}
+	return w.post(ctx, payload)
+}
+
+func (w *Webhook) post(ctx context.Context, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal webhook payload, %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request, %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("send request, %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected response code %v", resp.StatusCode)
+	}
+	return nil
+}
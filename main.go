@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/sebnyberg/policefeed/cmd/migrate"
+	"github.com/sebnyberg/policefeed/cmd/regions"
+	"github.com/sebnyberg/policefeed/cmd/search"
 	"github.com/sebnyberg/policefeed/cmd/server"
 	"github.com/sebnyberg/policefeed/cmd/subscribe"
 	"github.com/urfave/cli/v2"
@@ -18,7 +21,13 @@ func main() {
 		Usage:    "Police Event Feed",
 		Commands: []*cli.Command{
 			server.NewServerCmd(),
+			server.NewSyncCmd(),
+			server.NewPruneCmd(),
 			subscribe.NewSubscribeCmd(),
+			search.NewSearchCmd(),
+			regions.NewRegionsCmd(),
+			migrate.NewMigrateCmd(),
+			server.NewConfigCmd(),
 		},
 	}
 